@@ -12,27 +12,45 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// Actions is the contents of an action file. It is a hash with currently only one element, an array auf Action objects
+// Actions is the contents of an action file. It consists of an array of
+// Action objects, rule templates and pattern sets, which can be used by the
+// rules of all actions
 type Actions struct {
-	Actions []Action `json:"actions" yaml:"actions"` // A list of actions
+	Include       []string             `json:"include" yaml:"include"`               // Globs of further action files to read, relative to the directory of this file
+	Actions       []Action             `json:"actions" yaml:"actions"`               // A list of actions
+	RuleTemplates map[string]Rule      `json:"rule_templates" yaml:"rule_templates"` // Rules which can be extended by the rules of the actions
+	PatternSets   map[string][]Pattern `json:"pattern_sets" yaml:"pattern_sets"`     // Named lists of patterns, which can be referenced in the patterns and excludes of the rules
 }
 
 // Action specifies one action to be execuded by the check. Currently, only Elasticsearch queries are supported
 type Action struct {
-	Name           string   `json:"name" yaml:"name"`             // Name of the action
-	History        uint64   `json:"history" yaml:"history"`       // Number of seconds to remember alarms
-	Index          string   `json:"index" yaml:"index"`           // Index name or pattern
-	Query          string   `json:"query" yaml:"query"`           // Query to be execuded
-	Rules          RuleList `json:"rule" yaml:"rules"`            // A list of rules to match the query results against
-	Limit          uint     `json:"limit" yaml:"limit"`           // Limit to this number of pages (a page is 1000 hits) per call to the check. This is important for not overloading the elöasticsearch cluster or running into timeouts
-	StatusFile     string   `json:"statusfile" yaml:"statusfile"` // Where to save the timestamp and history from this run for the next one
+	Name           string              `json:"name" yaml:"name"`               // Name of the action
+	History        uint64              `json:"history" yaml:"history"`         // Number of seconds to remember alarms
+	Index          string              `json:"index" yaml:"index"`             // Index name or pattern
+	Query          string              `json:"query" yaml:"query"`             // Query to be execuded
+	Rules          RuleList            `json:"rule" yaml:"rules"`              // A list of rules to match the query results against
+	Limit          uint                `json:"limit" yaml:"limit"`             // Limit to this number of pages (a page is 1000 hits) per call to the check. This is important for not overloading the elöasticsearch cluster or running into timeouts
+	StatusFile     string              `json:"statusfile" yaml:"statusfile"`   // Where to save the timestamp and history from this run for the next one
+	Vars           map[string]string   `json:"vars" yaml:"vars"`               // Variables which can be used as ${name} in all fields of the action
+	Matrix         map[string][]string `json:"matrix" yaml:"matrix"`           // The action is expanded into one action per combination of these values, which can be used like vars
+	Tests          []RuleTest          `json:"tests" yaml:"tests"`             // Sample documents and the rules they are expected to match, run by the selftest command
+	Maintenance    MaintenanceList     `json:"maintenance" yaml:"maintenance"` // Windows during which the states of all rules of the action are capped
 	last_timestamp string
+	sourceFile     string
+	replay         bool
+	evaluatedAt    time.Time
 	results        RuleCount
 	StatusData     *StatusData
 	orderedRules   OrderedRuleList
 }
 
 
+// Returns the name of the action together with the file it is defined in for
+// error messages
+func (a Action) location() string {
+	return a.Name + " (" + a.sourceFile + ")"
+}
+
 // countResults iterates over the data returned by an Elasticsearch search and checks for every hit (document) on which rule it matches
 func (s Action) countResults(result *elasticsearch.ElasticsearchResult) (string, error) {
 	var err error
@@ -40,34 +58,123 @@ func (s Action) countResults(result *elasticsearch.ElasticsearchResult) (string,
 	logger.Trace().Msg("Enter func")
 	last_timestamp := ""
 	for _, hit := range result.Hits.Hits {
-		s.results.Add("_total", nil, 0)
-		matches := false
-		for _, r := range s.orderedRules {
-			rulename, rule:=r.Get(s.Rules)
-			match, err := rule.isMatch(hit.Fields, hit.Id, rulename)
+		err = s.countHit(hit, nil)
+		if err != nil {
+			return "", err
+		}
+		last_timestamp, err = getTimestamp(hit, "@timestamp")
+		if err != nil {
+			return "", err
+		}
+	}
+	return last_timestamp, nil
+}
+
+// countHit checks a single hit against the ordered rules and counts it. If
+// Evaluation is not nil, the evaluation of every rule is recorded in it.
+func (s Action) countHit(hit elasticsearch.ElasticsearchHitList, Evaluation *HitEvaluation) error {
+	logger := log.With().Str("func", "Action.countHit").Str("package", "check").Logger()
+	s.results["_total"] = s.results.Add("_total", nil, 0)
+	matches := false
+	stopped := false
+	for _, r := range s.orderedRules {
+		rulename, rule:=r.Get(s.Rules)
+		if stopped {
+			if Evaluation != nil {
+				Evaluation.Rules = append(Evaluation.Rules, RuleEvaluation{Name: rulename, Rule: rule, Skipped: true})
+			}
+			continue
+		}
+		duplicates := s.results[rulename].Duplicates
+		match, err := s.applyRule(rulename, rule, hit)
+		if err != nil {
+			return err
+		}
+		logger.Trace().Str("id", "DBG20030001").Str("rule", rulename).Bool("match", match).Bool("stop_on_match", rule.StopOnMatch).Str("document_id", hit.Id).Msg("Apply rule " + rulename)
+		if Evaluation != nil {
+			e := RuleEvaluation{Name: rulename, Rule: rule, Match: match}
+			e.Duplicate = s.results[rulename].Duplicates > duplicates
+			err = rule.explainMatch(hit.Fields, &e)
 			if err != nil {
-				return "", err
+				return err
 			}
-			logger.Trace().Str("id", "DBG20030001").Str("rule", rulename).Bool("match", match).Bool("stop_on_match", rule.StopOnMatch).Str("document_id", hit.Id).Msg("Apply rule " + rulename)
-			if match {
-				matches = true
-				lines := rule.getOutputLines(hit)
-				s.results[rulename] = s.results.Add(rulename, lines, rule.OutputLines)
-				if rule.StopOnMatch {
-					logger.Trace().Str("id", "DBG20030001").Str("rule", rulename).Bool("match", match).Bool("stop_on_match", rule.StopOnMatch).Str("document_id", hit.Id).Msg("Match found, skipping remaining rules")
+			Evaluation.Rules = append(Evaluation.Rules, e)
+		}
+		if match {
+			matches = true
+			if rule.StopOnMatch {
+				logger.Trace().Str("id", "DBG20030001").Str("rule", rulename).Bool("match", match).Bool("stop_on_match", rule.StopOnMatch).Str("document_id", hit.Id).Msg("Match found, skipping remaining rules")
+				stopped = true
+				if Evaluation == nil {
 					break
 				}
 			}
 		}
-		if !matches {
-			s.results.Add("_nomatch", nil, 0)
+	}
+	if !matches {
+		s.results["_nomatch"] = s.results.Add("_nomatch", nil, 0)
+	}
+	return nil
+}
+
+// applyRule checks a hit against a rule and counts it according to the type
+// of the rule. Returns true, if the hit matched the rule.
+func (s Action) applyRule(rulename string, rule Rule, hit elasticsearch.ElasticsearchHitList) (bool, error) {
+	switch rule.Type {
+	case ruleTypeSequence, ruleTypeLatency, ruleTypeNewValue, ruleTypeTemplate:
+		key, duplicate := s.isDuplicate(rulename, rule, hit)
+		if duplicate {
+			return true, nil
 		}
-		last_timestamp, err = getTimestamp(hit, "@timestamp")
-		if err != nil {
-			return "", err
+		var match bool
+		var err error
+		switch rule.Type {
+		case ruleTypeSequence:
+			match, err = s.matchSequence(rulename, rule, hit)
+		case ruleTypeLatency:
+			match, err = s.matchLatency(rulename, rule, hit)
+		case ruleTypeNewValue:
+			match, err = s.matchNewValue(rulename, rule, hit)
+		case ruleTypeTemplate:
+			match, err = s.matchTemplate(rulename, rule, hit)
 		}
+		if match {
+			s.seen(rulename, key, hit)
+		}
+		return match, err
 	}
-	return last_timestamp, nil
+	match, err := rule.isMatch(hit.Fields, hit.Id, rulename)
+	if err != nil || !match {
+		return false, err
+	}
+	key, duplicate := s.isDuplicate(rulename, rule, hit)
+	if duplicate {
+		return true, nil
+	}
+	s.results[rulename] = s.results.AddHit(rulename, rule, hit)
+	s.seen(rulename, key, hit)
+	return true, nil
+}
+
+// Sets the timestamp for the next run. Empty timestamps from pages without
+// hits are ignored.
+func (a *Action) setTimestamp(Timestamp string) {
+	if Timestamp != "" {
+		a.StatusData.Timestamp = Timestamp
+	}
+}
+
+// finishRun is called after all pages of the search have been processed and
+// handles everything depending on the end of the run instead of single hits.
+func (a Action) finishRun() {
+	processed, ok := a.processedTime()
+	if ok {
+		a.expireSequences(processed)
+		a.expireLatencies(processed)
+	}
+	a.expireDedupeKeys(a.evaluationTime())
+	a.expireKnownValues(a.evaluationTime())
+	a.expireTemplates(a.evaluationTime())
 }
 
 // getTimestamp retrieves a timestamp from the elasticsearch hit
@@ -99,47 +206,61 @@ func (a Action) outputResults(nagios *nagiosplugin.Check, command string) {
 	logger := log.With().Str("func", "Action.outputResults").Str("package", "check").Logger()
 	logger.Trace().Msg("Enter func")
 	ts := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	if m := a.Maintenance.active(a.evaluationTime()); m != nil {
+		nagios.AddLongPluginOutput(fmt.Sprintf("Search %v: %v", a.Name, m))
+	}
+	if until, ok := a.StatusData.snoozedUntil("", "", "", a.evaluationTime()); ok {
+		nagios.AddLongPluginOutput(fmt.Sprintf("Search %v is snoozed until %v", a.Name, formatTimestamp(until)))
+	}
 	for _, r := range a.orderedRules {
 		rulename, rule:=r.Get(a.Rules)
-		c := a.results.Count(rulename)
-		logger := logger.With().Str("search", a.Name).Str("rule", rulename).Uint64("value", c).Logger()
-		if rule.critRange.CheckUint64(c) {
-			logger.Debug().Str("id", "DBG20080001").Str("threshold", rule.Critical).Str("type", "critical").Msg("Critical threshold reached")
-			nagios.AddResult(nagiosplugin.CRITICAL, fmt.Sprintf("%v/%v", a.Name, rulename))
-			nagios.AddLongPluginOutput(fmt.Sprintf("Value %v for rule %v in search %v exceeds threshold %v", c, rulename, a.Name, rule.Critical))
-			lines := a.results[rulename].OutputRuleCountLines(nagios, rule.OutputLines)
-			if a.History > 0 {
-				a.StatusData.AddHistoryEntry(ts, int(nagiosplugin.CRITICAL), rulename, c, lines)
-				if command != "" {
-					h:=a.StatusData.History[len(a.StatusData.History)-1]
-					nagios.AddLongPluginOutput(command+ "-U " +  h.Uuid)
-				}
-			}
-		} else {
-			if rule.warnRange.CheckUint64(c) {
-				logger.Debug().Str("id", "DBG20080002").Str("threshold", rule.Warning).Str("type", "warning").Msg("Warning threshold reached")
-				nagios.AddResult(nagiosplugin.WARNING, fmt.Sprintf("%v/%v", a.Name, rulename))
-				nagios.AddLongPluginOutput(fmt.Sprintf("Value %v for rule %v in search %v exceeds threshold %v", c, rulename, a.Name, rule.Warning))
-				lines := a.results[rulename].OutputRuleCountLines(nagios, rule.OutputLines)
-				if a.History > 0 {
-					a.StatusData.AddHistoryEntry(ts, int(nagiosplugin.WARNING), rulename, c, lines)
-					if command != "" {
-						h:=a.StatusData.History[len(a.StatusData.History)-1]
-						nagios.AddLongPluginOutput(command+ "-U " +  h.Uuid)
-					}
-				}
-			} else {
-				logger.Debug().Str("id", "DBG20080003").Str("type", "ok").Msg("No threshold reached")
-				nagios.AddResult(nagiosplugin.OK, fmt.Sprintf("%v/%v", a.Name, rulename))
-				nagios.AddLongPluginOutput(fmt.Sprintf("Value %v for rule %v in search %v is within thresholds %v,%v	", c, rulename, a.Name, rule.Warning, rule.Critical))
-			}
+		rule = rule.scheduled(a.evaluationTime())
+		if m := rule.Maintenance.active(a.evaluationTime()); m != nil {
+			nagios.AddLongPluginOutput(fmt.Sprintf("Rule %v in search %v: %v", rulename, a.Name, m))
 		}
 		metric_name := rule.MetricName
 		if metric_name == "" {
 			metric_name = rulename
 		}
-		v, _ := nagiosplugin.NewFloatPerfDatumValue(float64(c))
-		nagios.AddPerfDatum(metric_name, "c", v, rule.warnRange, rule.critRange, nil, nil)
+		entry := a.results[rulename]
+		if len(rule.GroupBy) == 0 {
+			status, message := a.evaluate(rulename, rule, entry)
+			a.report(nagios, command, ts, rulename, "", rule, status, message, entry)
+			a.addRulePerfData(nagios, metric_name, rulename, rule, entry)
+			a.addDuplicatePerfData(nagios, metric_name, rule, entry)
+			a.updateBaseline(rulename, rule, entry)
+			continue
+		}
+		breached := 0
+		groups := entry.SortedGroups()
+		if rule.usesMode(thresholdSigma) {
+			var untracked []string
+			a.StatusData.pruneGroupBaselines(rulename, rule.MaxGroups)
+			groups, untracked = a.StatusData.trackedGroups(rulename, entry, rule.MaxGroups)
+			a.reportUntracked(nagios, rulename, rule, untracked)
+		}
+		for i, group := range groups {
+			g := entry.Groups[group]
+			name := rulename + "[" + group + "]"
+			status, message := a.evaluate(name, rule, g)
+			if status != nagiosplugin.OK {
+				a.report(nagios, command, ts, rulename, group, rule, status, message, g)
+				breached++
+			}
+			if i < rule.MaxGroups {
+				a.addRulePerfData(nagios, metric_name+"_"+perfLabel(group), name, rule, g)
+				a.updateBaseline(name, rule, g)
+			}
+		}
+		logger.Debug().Str("id", "DBG20080005").Str("rule", rulename).Int("groups", len(groups)).Int("breached", breached).Msg("Evaluated groups")
+		value, description := entry.Value(rule)
+		if breached == 0 {
+			nagios.AddResult(nagiosplugin.OK, fmt.Sprintf("%v/%v", a.Name, rulename))
+			nagios.AddLongPluginOutput(fmt.Sprintf("%v for rule %v in search %v is within thresholds %v,%v%v in all %v groups", description, rulename, a.Name, rule.Warning, rule.Critical, rule.scheduleNote(), len(groups)))
+		}
+		v, _ := nagiosplugin.NewFloatPerfDatumValue(value)
+		nagios.AddPerfDatum(metric_name, rule.perfUnit(), v, nil, nil, nil, nil)
+		a.addDuplicatePerfData(nagios, metric_name, rule, entry)
 	}
 	t, _ := nagiosplugin.NewFloatPerfDatumValue(float64(a.results.Count("_total")))
 	nagios.AddPerfDatum(a.Name+"_lines", "c", t, nil, nil, nil, nil)
@@ -149,17 +270,293 @@ func (a Action) outputResults(nagios *nagiosplugin.Check, command string) {
 	return
 }
 
+// Adds the number of duplicate hits for rules using dedupe_key
+func (a Action) addDuplicatePerfData(nagios *nagiosplugin.Check, MetricName string, rule Rule, entry RuleCountEntry) {
+	if len(rule.DedupeKey) == 0 {
+		return
+	}
+	d, _ := nagiosplugin.NewFloatPerfDatumValue(float64(entry.Duplicates))
+	nagios.AddPerfDatum(MetricName+"_duplicates", "c", d, nil, nil, nil, nil)
+}
+
+// Reports the groups of a rule using a baseline, which are not evaluated
+// because the baselines of max_groups other groups are already tracked
+func (a Action) reportUntracked(nagios *nagiosplugin.Check, rulename string, rule Rule, Untracked []string) {
+	if len(Untracked) == 0 {
+		return
+	}
+	list := Untracked
+	if len(list) > rule.MaxGroups {
+		list = append(list[:rule.MaxGroups:rule.MaxGroups], "...")
+	}
+	nagios.AddLongPluginOutput(fmt.Sprintf("%v groups of rule %v in search %v are untracked and not evaluated, baselines are kept for %v groups only: %v", len(Untracked), rulename, a.Name, rule.MaxGroups, strings.Join(list, ", ")))
+}
+
+// Compares the value of a rule (or one group of a rule) against the
+// thresholds. Name is the name of the rule, for groups the group key is
+// appended in brackets. Returns the resulting state and a message for the
+// long plugin output.
+func (a Action) evaluate(Name string, rule Rule, entry RuleCountEntry) (nagiosplugin.Status, string) {
+	logger := log.With().Str("func", "Action.evaluate").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	total := a.results.Count("_total")
+	critValue, description, critOk := a.ruleValue(Name, rule, rule.critMode, entry)
+	warnValue, warnDescription, warnOk := a.ruleValue(Name, rule, rule.warnMode, entry)
+	if rule.warnMode != rule.critMode && !strings.HasPrefix(description, warnDescription) {
+		description = description + ", " + warnDescription
+	}
+	logger = logger.With().Str("search", a.Name).Str("rule", Name).Str("schedule", rule.schedule).Uint64("count", entry.Count).Float64("value", critValue).Logger()
+	if total < rule.MinTotal {
+		logger.Debug().Str("id", "DBG20080004").Uint64("total", total).Uint64("min_total", rule.MinTotal).Msg("Not enough lines to evaluate rule")
+		return nagiosplugin.OK, fmt.Sprintf("Rule %v in search %v not evaluated, only %v of at least %v lines read", Name, a.Name, total, rule.MinTotal)
+	}
+	if critOk && rule.critRange.Check(critValue) {
+		logger.Debug().Str("id", "DBG20080001").Str("threshold", rule.Critical).Str("type", "critical").Msg("Critical threshold reached")
+		return nagiosplugin.CRITICAL, fmt.Sprintf("%v for rule %v in search %v exceeds threshold %v%v", description, Name, a.Name, rule.Critical, rule.scheduleNote())
+	}
+	if warnOk && rule.warnRange.Check(warnValue) {
+		logger.Debug().Str("id", "DBG20080002").Str("threshold", rule.Warning).Str("type", "warning").Msg("Warning threshold reached")
+		return nagiosplugin.WARNING, fmt.Sprintf("%v for rule %v in search %v exceeds threshold %v%v", description, Name, a.Name, rule.Warning, rule.scheduleNote())
+	}
+	logger.Debug().Str("id", "DBG20080003").Str("type", "ok").Msg("No threshold reached")
+	return nagiosplugin.OK, fmt.Sprintf("%v for rule %v in search %v is within thresholds %v,%v%v", description, Name, a.Name, rule.Warning, rule.Critical, rule.scheduleNote())
+}
+
+// Reports the state of a rule (or one group of a rule) to Nagios. For states
+// other than OK, the output lines are added and a history entry is created.
+// During a maintenance window, the state is capped and no history entry is
+// created.
+func (a Action) report(nagios *nagiosplugin.Check, command string, ts string, rulename string, group string, rule Rule, status nagiosplugin.Status, message string, entry RuleCountEntry) {
+	logger := log.With().Str("func", "Action.report").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	name := rulename
+	if group != "" {
+		name = rulename + "[" + group + "]"
+	}
+	window := a.maintenance(rule)
+	if capped := window.cap(status); capped != status {
+		logger.Debug().Str("id", "DBG20280001").
+			Str("search", a.Name).
+			Str("rule", name).
+			Str("state", status.String()).
+			Str("maintenance", window.window.String()).
+			Msg("State capped by maintenance window")
+		message = fmt.Sprintf("%v, %v capped at %v by maintenance window %v", message, status, capped, window.window)
+		status = capped
+	}
+	until, snoozed := a.StatusData.snoozedUntil("", rulename, name, a.evaluationTime())
+	if snoozed && status != nagiosplugin.OK {
+		logger.Debug().Str("id", "DBG20290002").
+			Str("search", a.Name).
+			Str("rule", name).
+			Str("state", status.String()).
+			Time("until", until).
+			Msg("State silenced by snooze")
+		message = fmt.Sprintf("%v, %v silenced by snooze until %v", message, status, formatTimestamp(until))
+		status = nagiosplugin.OK
+	}
+	nagios.AddResult(status, fmt.Sprintf("%v/%v", a.Name, name))
+	nagios.AddLongPluginOutput(message)
+	if status == nagiosplugin.OK {
+		return
+	}
+	lines := entry.OutputRuleCountLines(nagios, rule.OutputLines)
+	if a.History > 0 && !a.replay && window == nil && !snoozed {
+		a.StatusData.AddHistoryEntry(ts, int(status), rulename, group, entry.Count, lines)
+		if command != "" {
+			h := a.StatusData.History[len(a.StatusData.History)-1]
+			nagios.AddLongPluginOutput(command + " -U " + h.Uuid)
+		}
+	}
+}
+
+// Replaces whitespace, ' and = in a value of a field, which would break the
+// performance data when used in a label
+func perfLabel(Value string) string {
+	return illegalMetricRegex.ReplaceAllString(Value, "_")
+}
+
+// Adds the current value of a rule to its baseline, if one of its thresholds
+// uses the baseline. Name is the name of the rule, for groups the group key is
+// appended in brackets.
+func (a Action) updateBaseline(Name string, rule Rule, entry RuleCountEntry) {
+	if !rule.usesMode(thresholdSigma) {
+		return
+	}
+	value, _, _ := a.ruleValue(Name, rule, thresholdAbsolute, entry)
+	a.StatusData.Baseline(Name).Add(a.evaluationTime(), value, rule.BaselineSamples)
+}
+
+// Returns the value of a rule to be compared against a range with the given
+// mode together with a description of that value for the output. The last
+// return value is false, if the value can't be determined yet, e.g. because
+// the baseline is still warming up. Name is used to look up the baseline.
+func (a Action) ruleValue(Name string, rule Rule, Mode thresholdMode, entry RuleCountEntry) (float64, string, bool) {
+	value, description := entry.Value(rule)
+	switch Mode {
+	case thresholdPercent:
+		total := a.results.Count("_total")
+		if total == 0 {
+			return 0, "Percentage 0% of 0 lines", true
+		}
+		p := value * 100 / float64(total)
+		return p, fmt.Sprintf("Percentage %.2f%% of %v lines", p, total), true
+	case thresholdSigma:
+		value, description, _ := a.ruleValue(Name, rule, thresholdAbsolute, entry)
+		var baseline *Baseline
+		if a.StatusData != nil {
+			baseline = a.StatusData.Baselines[Name]
+		}
+		d, ok := baseline.Deviation(a.evaluationTime(), value, rule.baselineWarmup, rule.BaselineMinDeviation)
+		if !ok {
+			return 0, description + " (baseline warming up)", false
+		}
+		return d, fmt.Sprintf("%v deviating %.2f sigma from baseline", description, d), true
+	}
+	if rule.rateUnit > 0 {
+		r := a.rate(value, rule.rateUnit)
+		return r, fmt.Sprintf("%v, rate %.3f/%v", description, r, rule.Rate), true
+	}
+	return value, description, true
+}
+
+// Adds the performance data for a rule. The value of the rule (the number of
+// hits, distinct values or the statistic) is always reported, the rate, percentage and
+// deviation only if they are used by the thresholds. Each range is attached
+// to the metric it is compared against.
+func (a Action) addRulePerfData(nagios *nagiosplugin.Check, MetricName string, Name string, rule Rule, entry RuleCountEntry) {
+	warn := rangeForMode(rule.warnRange, rule.warnMode, thresholdAbsolute)
+	crit := rangeForMode(rule.critRange, rule.critMode, thresholdAbsolute)
+	value, _ := entry.Value(rule)
+	v, _ := nagiosplugin.NewFloatPerfDatumValue(value)
+	unit := rule.perfUnit()
+	if rule.DistinctField != "" || rule.usesStatistic() {
+		h, _ := nagiosplugin.NewFloatPerfDatumValue(float64(entry.Count))
+		nagios.AddPerfDatum(MetricName+"_hits", "c", h, nil, nil, nil, nil)
+	}
+	if rule.Type == ruleTypeLatency {
+		for _, kind := range []string{"avg", "max"} {
+			if kind == rule.statistic {
+				continue
+			}
+			s := NewStatistic(kind, 0)
+			if entry.Stats != nil {
+				*s = *entry.Stats
+				s.Kind = kind
+			}
+			sv, _ := nagiosplugin.NewFloatPerfDatumValue(s.Value())
+			nagios.AddPerfDatum(MetricName+"_"+kind, unit, sv, nil, nil, nil, nil)
+		}
+	}
+	if rule.rateUnit > 0 {
+		nagios.AddPerfDatum(MetricName, unit, v, nil, nil, nil, nil)
+		r, _ := nagiosplugin.NewFloatPerfDatumValue(a.rate(value, rule.rateUnit))
+		nagios.AddPerfDatum(MetricName+"_rate", "", r, warn, crit, nil, nil)
+	} else {
+		nagios.AddPerfDatum(MetricName, unit, v, warn, crit, nil, nil)
+	}
+	if rule.usesMode(thresholdPercent) {
+		p, _, _ := a.ruleValue(Name, rule, thresholdPercent, entry)
+		pv, _ := nagiosplugin.NewFloatPerfDatumValue(p)
+		min := float64(0)
+		max := float64(100)
+		nagios.AddPerfDatum(MetricName+"_pct", "%", pv,
+			rangeForMode(rule.warnRange, rule.warnMode, thresholdPercent),
+			rangeForMode(rule.critRange, rule.critMode, thresholdPercent),
+			&min, &max)
+	}
+	if rule.usesMode(thresholdSigma) {
+		var sv nagiosplugin.PerfDatumValue
+		d, _, ok := a.ruleValue(Name, rule, thresholdSigma, entry)
+		if ok {
+			sv, _ = nagiosplugin.NewFloatPerfDatumValue(d)
+		} else {
+			sv = nagiosplugin.NewUndeterminedPerfDatumValue()
+		}
+		nagios.AddPerfDatum(MetricName+"_sigma", "", sv,
+			rangeForMode(rule.warnRange, rule.warnMode, thresholdSigma),
+			rangeForMode(rule.critRange, rule.critMode, thresholdSigma),
+			nil, nil)
+	}
+}
+
+// Returns the point in time the results are evaluated for. This is used to
+// select the baseline bucket. For a replay, this is the end of the time range.
+func (a Action) evaluationTime() time.Time {
+	if !a.evaluatedAt.IsZero() {
+		return a.evaluatedAt
+	}
+	return time.Now()
+}
+
+// Returns the point in time up to which the documents have been processed.
+// This is the cursor for the next run or, for a replay, the end of the time
+// range. Timeouts of open sequences and latencies are measured against it instead of the
+// wall clock, so events still waiting in the backlog are not missed. Returns
+// false, if there is no cursor yet.
+func (a Action) processedTime() (time.Time, bool) {
+	if !a.evaluatedAt.IsZero() {
+		return a.evaluatedAt, true
+	}
+	t, err := time.Parse(time.RFC3339Nano, a.StatusData.Timestamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Calculates the time span covered by the current run, which is the time
+// between the cursor from the previous run and the new cursor. If there is no
+// new cursor (no hits) or one of the timestamps can't be parsed, 0 is returned.
+func (a Action) span() time.Duration {
+	logger := log.With().Str("func", "Action.span").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	if a.StatusData == nil || a.StatusData.Timestamp == "" || a.last_timestamp == "" {
+		return 0
+	}
+	from, err := time.Parse(time.RFC3339Nano, a.last_timestamp)
+	if err != nil {
+		logger.Warn().Str("id", "WRN20090001").Str("timestamp", a.last_timestamp).Err(err).Msg("Could not parse previous timestamp")
+		return 0
+	}
+	to, err := time.Parse(time.RFC3339Nano, a.StatusData.Timestamp)
+	if err != nil {
+		logger.Warn().Str("id", "WRN20090002").Str("timestamp", a.StatusData.Timestamp).Err(err).Msg("Could not parse current timestamp")
+		return 0
+	}
+	return to.Sub(from)
+}
+
+// Calculates the value per Unit over the time span of the current run
+func (a Action) rate(Value float64, Unit time.Duration) float64 {
+	s := a.span()
+	if s <= 0 {
+		return 0
+	}
+	return Value / s.Seconds() * Unit.Seconds()
+}
+
 // Generate the Nagios output for historic data stored in the status file
 func (a Action) HistoricResults(nagios *nagiosplugin.Check, command string) {
 	var n nagiosplugin.Status
 	var hc int
 	logger := log.With().Str("func", "HistoricResults").Str("package", "check").Logger()
 	logger.Trace().Msg("Enter func")
-	if a.StatusData == nil {
+	if a.StatusData == nil || a.replay {
 		return
 	}
 	for _, h := range a.StatusData.History {
+		if h.Handled && !h.current {
+			if ack, ok := h.LastAcknowledgement(); ok {
+				nagios.AddLongPluginOutput(fmt.Sprintf("Handled historic event %v for rule %v for action %v: %v", h.Uuid, h.RuleName(), a.Name, ack))
+			}
+			continue
+		}
 		if !h.Handled && !h.current {
+			if until, ok := a.StatusData.snoozedUntil(h.Uuid, h.Rule, h.RuleName(), a.evaluationTime()); ok {
+				nagios.AddLongPluginOutput(fmt.Sprintf("Unhandled historic event %v for rule %v for action %v is snoozed until %v", h.Uuid, h.RuleName(), a.Name, formatTimestamp(until)))
+				continue
+			}
 			switch h.State {
 			case 1:
 				n = nagiosplugin.WARNING
@@ -170,11 +567,20 @@ func (a Action) HistoricResults(nagios *nagiosplugin.Check, command string) {
 			default:
 				n = nagiosplugin.OK
 			}
-			nagios.AddResult(n, fmt.Sprintf("%v/%v (historic)", a.Name, h.Rule))
-			nagios.AddLongPluginOutput(fmt.Sprintf("Reporting unhandled historic event %v for rule %v for action %v which occurred on %v", h.Uuid, h.Rule, a.Name, h.Timestamp))
+			message := fmt.Sprintf("Reporting unhandled historic event %v for rule %v for action %v which occurred on %v", h.Uuid, h.RuleName(), a.Name, h.Timestamp)
+			window := a.maintenance(a.Rules[h.Rule])
+			if capped := window.cap(n); capped != n {
+				message = fmt.Sprintf("%v, %v capped at %v by maintenance window %v", message, n, capped, window.window)
+				n = capped
+			}
+			nagios.AddResult(n, fmt.Sprintf("%v/%v (historic)", a.Name, h.RuleName()))
+			nagios.AddLongPluginOutput(message)
 			if command != "" {
 				nagios.AddLongPluginOutput(command+ " -U " +  h.Uuid)
 			}
+			if ack, ok := h.LastAcknowledgement(); ok {
+				nagios.AddLongPluginOutput(fmt.Sprintf("   %v", ack))
+			}
 			for _, l := range h.Lines {
 				nagios.AddLongPluginOutput(fmt.Sprintf("   %s", l))
 			}
@@ -0,0 +1,188 @@
+package check
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// An action file read as YAML document
+type actionDocument struct {
+	file     string
+	document yaml.Node
+}
+
+// Reads the action files and the files they include. Every file is only read
+// once, even if it is included multiple times.
+type actionFileLoader struct {
+	documents []actionDocument
+	seen      map[string]bool
+}
+
+// Returns the action files to read for the given path. For a directory, this
+// are all files ending with .yaml or .yml in it, sorted by name.
+func actionFiles(Path string) ([]string, error) {
+	info, err := os.Stat(Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{Path}, nil
+	}
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		f, err := filepath.Glob(filepath.Join(Path, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Reads an action file and all files matching the globs in its include list.
+// Relative globs are relative to the directory of the including file.
+func (l *actionFileLoader) load(File string) error {
+	logger := log.With().Str("func", "actionFileLoader.load").Str("package", "check").Str("filename", File).Logger()
+	logger.Trace().Msg("Enter func")
+	abs, err := filepath.Abs(File)
+	if err != nil {
+		return err
+	}
+	if l.seen[abs] {
+		logger.Debug().Str("id", "DBG20010002").Msg("Action file already read")
+		return nil
+	}
+	l.seen[abs] = true
+	logger.Debug().Str("id", "DBG20010001").Msg("Read action file")
+	f, err := ioutil.ReadFile(File)
+	if err != nil {
+		logger.Error().Str("id", "ERR20010001").Err(err).Msg("Failed to read action file")
+		return err
+	}
+	d := actionDocument{file: File}
+	err = yaml.Unmarshal(f, &d.document)
+	if err != nil {
+		logger.Error().Str("id", "ERR20010002").Err(err).Msg("Error unmarshalling yaml config file")
+		return fmt.Errorf("%v: %v", File, err)
+	}
+	l.documents = append(l.documents, d)
+	if len(d.document.Content) == 0 {
+		return nil
+	}
+	include := mappingValue(d.document.Content[0], "include")
+	if include == nil {
+		return nil
+	}
+	if include.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%v: line %v: include must be a list of file names", File, include.Line)
+	}
+	for _, i := range include.Content {
+		glob := i.Value
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(filepath.Dir(File), glob)
+		}
+		files, err := filepath.Glob(glob)
+		if err != nil {
+			return fmt.Errorf("%v: line %v: %v", File, i.Line, err)
+		}
+		if len(files) == 0 {
+			logger.Warn().Str("id", "WRN20010001").Str("include", i.Value).Msg("No files found for include")
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			err = l.load(file)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Combines the rule templates of all documents into one YAML mapping node
+func (l *actionFileLoader) ruleTemplates() (*yaml.Node, error) {
+	templates := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	files := make(map[string]string)
+	for _, d := range l.documents {
+		if len(d.document.Content) == 0 {
+			continue
+		}
+		t := mappingValue(d.document.Content[0], "rule_templates")
+		if t == nil || t.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(t.Content); i += 2 {
+			name := t.Content[i].Value
+			if f, ok := files[name]; ok {
+				return nil, fmt.Errorf("%v: line %v: rule template %v is already defined in %v", d.file, t.Content[i].Line, name, f)
+			}
+			files[name] = d.file
+			templates.Content = append(templates.Content, t.Content[i], t.Content[i+1])
+		}
+	}
+	return templates, nil
+}
+
+// Decodes all documents and merges them into one Actions object. Action names
+// and the names of pattern sets must be unique over all files.
+func (l *actionFileLoader) actions() (*Actions, error) {
+	templates, err := l.ruleTemplates()
+	if err != nil {
+		return nil, err
+	}
+	actions := new(Actions)
+	actionFiles := make(map[string]string)
+	patternSetFiles := make(map[string]string)
+	for i := range l.documents {
+		d := &l.documents[i]
+		err = resolveRuleTemplates(&d.document, templates)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", d.file, err)
+		}
+		err = expandMatrix(&d.document)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", d.file, err)
+		}
+		part := new(Actions)
+		err = d.document.Decode(part)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", d.file, err)
+		}
+		for _, a := range part.Actions {
+			if f, ok := actionFiles[a.Name]; ok {
+				return nil, fmt.Errorf("%v: action %v is already defined in %v", d.file, a.Name, f)
+			}
+			actionFiles[a.Name] = d.file
+			a.sourceFile = d.file
+			actions.Actions = append(actions.Actions, a)
+		}
+		for name, set := range part.PatternSets {
+			if f, ok := patternSetFiles[name]; ok {
+				return nil, fmt.Errorf("%v: pattern set %v is already defined in %v", d.file, name, f)
+			}
+			patternSetFiles[name] = d.file
+			if actions.PatternSets == nil {
+				actions.PatternSets = make(map[string][]Pattern)
+			}
+			actions.PatternSets[name] = set
+		}
+		for name, rule := range part.RuleTemplates {
+			if actions.RuleTemplates == nil {
+				actions.RuleTemplates = make(RuleList)
+			}
+			actions.RuleTemplates[name] = rule
+		}
+	}
+	err = actions.resolvePatternSets()
+	if err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
@@ -0,0 +1,141 @@
+package check
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A Baseline stores what is considered normal for the value of a rule. The
+// values are collected in one bucket per hour of the week to reflect daily
+// and weekly patterns.
+type Baseline struct {
+	Started string                  `json:"started" yaml:"started"`                     // Timestamp of the first sample, used for the warm-up period
+	Updated string                  `json:"updated,omitempty" yaml:"updated,omitempty"` // Timestamp of the last sample, used to forget the baselines of groups
+	Buckets map[int]*BaselineBucket `json:"buckets" yaml:"buckets"`                     // Buckets by hour of the week (0 is sunday 00:00-00:59)
+}
+
+// A BaselineBucket contains the rolling mean and variance of the values seen
+// during one hour of the week.
+type BaselineBucket struct {
+	Samples  uint64  `json:"samples" yaml:"samples"`   // Number of samples, capped at the configured maximum
+	Mean     float64 `json:"mean" yaml:"mean"`         // Rolling mean of the samples
+	Variance float64 `json:"variance" yaml:"variance"` // Rolling variance of the samples
+}
+
+// Returns the bucket number for the given time
+func baselineBucket(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// Add a value to the bucket for the given time. Once MaxSamples is reached,
+// older samples lose weight exponentially, so the baseline follows slow
+// changes.
+func (b *Baseline) Add(Now time.Time, Value float64, MaxSamples uint64) {
+	logger := log.With().Str("func", "Baseline.Add").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	if b.Started == "" {
+		b.Started = Now.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	b.Updated = Now.UTC().Format("2006-01-02T15:04:05.000Z")
+	if b.Buckets == nil {
+		b.Buckets = make(map[int]*BaselineBucket)
+	}
+	key := baselineBucket(Now)
+	bucket, ok := b.Buckets[key]
+	if !ok {
+		bucket = new(BaselineBucket)
+		b.Buckets[key] = bucket
+	}
+	if bucket.Samples < MaxSamples || MaxSamples == 0 {
+		bucket.Samples++
+	}
+	delta := Value - bucket.Mean
+	alpha := 1 / float64(bucket.Samples)
+	bucket.Mean += alpha * delta
+	bucket.Variance = (1 - alpha) * (bucket.Variance + alpha*delta*delta)
+	logger.Trace().Str("id", "DBG20150001").Int("bucket", key).Float64("value", Value).Float64("mean", bucket.Mean).Float64("variance", bucket.Variance).Msg("Updated baseline")
+}
+
+// Returns the deviation of Value from the mean of the bucket for the given
+// time in multiples of the standard deviation. MinDeviation is the lower
+// limit for the standard deviation. The second return value is false, if the
+// warm-up period has not passed yet or the bucket has too few samples.
+func (b *Baseline) Deviation(Now time.Time, Value float64, Warmup time.Duration, MinDeviation float64) (float64, bool) {
+	if b == nil || b.Started == "" {
+		return 0, false
+	}
+	started, err := time.Parse("2006-01-02T15:04:05.000Z", b.Started)
+	if err != nil || Now.Sub(started) < Warmup {
+		return 0, false
+	}
+	bucket, ok := b.Buckets[baselineBucket(Now)]
+	if !ok || bucket.Samples < 2 {
+		return 0, false
+	}
+	deviation := math.Max(math.Sqrt(bucket.Variance), MinDeviation)
+	if deviation == 0 {
+		return 0, false
+	}
+	return (Value - bucket.Mean) / deviation, true
+}
+
+// Splits the groups of a rule using a baseline into the tracked and the
+// untracked ones. The groups which already have a baseline are tracked, even
+// if they have no hits in this run, so they get a 0 sample. The remaining
+// places up to Max are taken by the groups with the most hits. The tracked
+// groups with hits come first, sorted like SortedGroups.
+func (status *StatusData) trackedGroups(Rule string, entry RuleCountEntry, Max int) ([]string, []string) {
+	var tracked, untracked, absent []string
+	known := make(map[string]bool)
+	for name := range status.Baselines {
+		if strings.HasPrefix(name, Rule+"[") && strings.HasSuffix(name, "]") {
+			known[strings.TrimSuffix(strings.TrimPrefix(name, Rule+"["), "]")] = true
+		}
+	}
+	free := Max - len(known)
+	for _, group := range entry.SortedGroups() {
+		switch {
+		case known[group]:
+			tracked = append(tracked, group)
+			delete(known, group)
+		case free > 0:
+			tracked = append(tracked, group)
+			free--
+		default:
+			untracked = append(untracked, group)
+		}
+	}
+	for group := range known {
+		absent = append(absent, group)
+	}
+	sort.Strings(absent)
+	return append(tracked, absent...), untracked
+}
+
+// Forgets the baselines of the groups of a rule except for the Max ones
+// updated last, so the status file doesn't grow with the number of values of
+// the group_by fields
+func (status *StatusData) pruneGroupBaselines(Rule string, Max int) {
+	logger := log.With().Str("func", "StatusData.pruneGroupBaselines").Str("package", "check").Str("rule", Rule).Logger()
+	logger.Trace().Msg("Enter func")
+	var groups []string
+	for name := range status.Baselines {
+		if strings.HasPrefix(name, Rule+"[") {
+			groups = append(groups, name)
+		}
+	}
+	if len(groups) <= Max {
+		return
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return status.Baselines[groups[i]].Updated > status.Baselines[groups[j]].Updated
+	})
+	for _, name := range groups[Max:] {
+		logger.Debug().Str("id", "DBG20150002").Str("group", name).Msg("Forget baseline of group")
+		delete(status.Baselines, name)
+	}
+}
@@ -0,0 +1,42 @@
+package check
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrackedGroups(t *testing.T) {
+	entry := RuleCountEntry{Groups: map[string]RuleCountEntry{
+		"web01": {Count: 5},
+		"web02": {Count: 3},
+		"web03": {Count: 1},
+	}}
+	tests := []struct {
+		name      string
+		baselines []string
+		max       int
+		tracked   []string
+		untracked []string
+	}{
+		{"no baselines", nil, 2, []string{"web01", "web02"}, []string{"web03"}},
+		{"known groups first", []string{"errors[web03]"}, 2, []string{"web01", "web03"}, []string{"web02"}},
+		{"known group without hits", []string{"errors[web04]", "errors[web03]"}, 2, []string{"web03", "web04"}, []string{"web01", "web02"}},
+		{"other rule", []string{"other[web03]", "errors"}, 2, []string{"web01", "web02"}, []string{"web03"}},
+		{"enough room", []string{"errors[web04]"}, 10, []string{"web01", "web02", "web03", "web04"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &StatusData{Baselines: make(map[string]*Baseline)}
+			for _, name := range tt.baselines {
+				status.Baselines[name] = new(Baseline)
+			}
+			tracked, untracked := status.trackedGroups("errors", entry, tt.max)
+			if !reflect.DeepEqual(tracked, tt.tracked) {
+				t.Errorf("tracked %v, expected %v", tracked, tt.tracked)
+			}
+			if !reflect.DeepEqual(untracked, tt.untracked) {
+				t.Errorf("untracked %v, expected %v", untracked, tt.untracked)
+			}
+		})
+	}
+}
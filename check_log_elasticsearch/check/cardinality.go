@@ -0,0 +1,93 @@
+package check
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Precision of the HyperLogLog estimation, the number of registers is 2^precision
+const hllPrecision = 14
+
+// Cardinality counts distinct values. Up to Limit values are counted exactly,
+// beyond that, the values are estimated by a HyperLogLog sketch to keep the
+// memory usage bounded.
+type Cardinality struct {
+	Limit     int                 // Maximum number of values counted exactly
+	values    map[string]struct{} // Exact set of values, nil once switched to HyperLogLog
+	registers []uint8             // HyperLogLog registers
+}
+
+// Create a new Cardinality counter counting up to Limit values exactly
+func NewCardinality(Limit int) *Cardinality {
+	c := new(Cardinality)
+	c.Limit = Limit
+	c.values = make(map[string]struct{})
+	return c
+}
+
+// Add a value to the counter
+func (c *Cardinality) Add(Value string) {
+	if c.registers == nil {
+		c.values[Value] = struct{}{}
+		if len(c.values) <= c.Limit {
+			return
+		}
+		c.registers = make([]uint8, 1<<hllPrecision)
+		for v := range c.values {
+			c.addHll(v)
+		}
+		c.values = nil
+		return
+	}
+	c.addHll(Value)
+}
+
+// Add a value to the HyperLogLog registers
+func (c *Cardinality) addHll(Value string) {
+	h := fnv.New64a()
+	h.Write([]byte(Value))
+	// FNV alone distributes short, similar values badly across the upper
+	// bits, so the result is mixed with the murmur3 finalizer
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > c.registers[idx] {
+		c.registers[idx] = rank
+	}
+}
+
+// Returns the number of distinct values, which is exact as long as the limit
+// has not been exceeded
+func (c *Cardinality) Count() uint64 {
+	if c == nil {
+		return 0
+	}
+	if c.registers == nil {
+		return uint64(len(c.values))
+	}
+	m := float64(len(c.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range c.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Returns true, if the number of distinct values is estimated
+func (c *Cardinality) IsEstimate() bool {
+	return c != nil && c.registers != nil
+}
@@ -0,0 +1,44 @@
+package check
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestCardinalityExact(t *testing.T) {
+	c := NewCardinality(100)
+	for i := 0; i < 300; i++ {
+		c.Add(fmt.Sprintf("user%v", i%100))
+	}
+	if c.IsEstimate() {
+		t.Errorf("counter switched to estimation below its limit")
+	}
+	if c.Count() != 100 {
+		t.Errorf("counted %v distinct values, expected 100", c.Count())
+	}
+}
+
+// The standard error of HyperLogLog is 1.04/sqrt(m), the estimate must be
+// within three times that from the exact number of distinct values
+func TestCardinalityEstimate(t *testing.T) {
+	maxError := 3 * 1.04 / math.Sqrt(float64(int(1)<<hllPrecision))
+	for _, n := range []int{1000, 20000, 100000, 1000000} {
+		t.Run(fmt.Sprintf("%v", n), func(t *testing.T) {
+			c := NewCardinality(100)
+			for i := 0; i < n; i++ {
+				c.Add(fmt.Sprintf("10.0.%v.%v", i/256, i%256))
+				if i%3 == 0 {
+					c.Add(fmt.Sprintf("10.0.%v.%v", i/256, i%256))
+				}
+			}
+			if !c.IsEstimate() {
+				t.Fatalf("counter didn't switch to estimation above its limit")
+			}
+			e := math.Abs(float64(c.Count())-float64(n)) / float64(n)
+			if e > maxError {
+				t.Errorf("estimated %v distinct values for %v, error %.4f exceeds %.4f", c.Count(), n, e, maxError)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package check
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"strings"
 	"time"
 	"os"
@@ -13,7 +12,6 @@ import (
 	"github.com/joernott/nagiosplugin/v2"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
 )
 
 //The Check object created and initialized by NewCheck consolidates the
@@ -25,6 +23,10 @@ type Check struct {
 	nagios      *nagiosplugin.Check
 	actions     *Actions
 	Command     string
+	DryRun      bool // Run the check without saving the status files
+	replay      bool
+	replayFrom  time.Time
+	replayTo    time.Time
 }
 
 // Creates a Check object containing the connection object to Elasticsearch, a
@@ -33,7 +35,6 @@ type Check struct {
 func NewCheck(ActionsFile string, Connection *elasticsearch.Elasticsearch, Nagios *nagiosplugin.Check, Command string) (*Check, error) {
 	var actions *Actions
 	var c *Check
-	var o OrderedRuleList
 	
 	logger := log.With().Str("func", "NewCheck").Str("package", "check").Logger()
 	logger.Trace().Msg("Enter func")
@@ -45,36 +46,112 @@ func NewCheck(ActionsFile string, Connection *elasticsearch.Elasticsearch, Nagio
 
 	actions, err := readActionFile(ActionsFile)
 	if err != nil {
-		c.nagios.AddResult(nagiosplugin.UNKNOWN, "Error parsing action file "+ActionsFile+": "+err.Error())
+		c.unknown("Error parsing action file "+ActionsFile+": "+err.Error())
 		return nil, err
 	}
 	for i := 0; i < len(actions.Actions); i++ {
+		var o OrderedRuleList
 		for rulename, rule := range actions.Actions[i].Rules {
 			r := rule
-			logger := logger.With().Str("search", actions.Actions[i].Name).Str("rule", rulename).Logger()
-			r.warnRange, err = nagiosplugin.ParseRange(rule.Warning)
+			logger := logger.With().Str("search", actions.Actions[i].Name).Str("file", actions.Actions[i].sourceFile).Str("rule", rulename).Logger()
+			r.warnRange, r.warnMode, err = parseThreshold(rule.Warning)
 			if err != nil {
 				logger.Error().Str("id", "ERR20000001").
 					Str("threshold", rule.Warning).
 					Str("type", "warning").
 					Err(err).
 					Msg("Error parsing range")
-				c.nagios.AddResult(nagiosplugin.UNKNOWN, "Error parsing warning range "+rule.Warning+" for rule "+rulename+" in search "+actions.Actions[i].Name)
+				c.unknown("Error parsing warning range "+rule.Warning+" for rule "+rulename+" in search "+actions.Actions[i].location())
 				return nil, err
 			}
-			r.critRange, err = nagiosplugin.ParseRange(rule.Critical)
+			r.critRange, r.critMode, err = parseThreshold(rule.Critical)
 			if err != nil {
 				logger.Error().Str("id", "ERR20000002").
 					Str("threshold", rule.Critical).
 					Str("type", "critical").
 					Err(err).
 					Msg("Error parsing range")
-				c.nagios.AddResult(nagiosplugin.UNKNOWN, "Error parsing critical range "+rule.Critical+" for rule "+rulename+" in search "+actions.Actions[i].Name)
+				c.unknown("Error parsing critical range "+rule.Critical+" for rule "+rulename+" in search "+actions.Actions[i].location())
+				return nil, err
+			}
+			err = r.initSchedules()
+			if err != nil {
+				logger.Error().Str("id", "ERR20000012").Err(err).Msg("Invalid threshold schedule")
+				c.unknown("Invalid configuration for rule "+rulename+" in search "+actions.Actions[i].location()+": "+err.Error())
+				return nil, err
+			}
+			r.rateUnit, err = parseRateUnit(rule.Rate)
+			if err != nil {
+				logger.Error().Str("id", "ERR20000004").
+					Str("rate", rule.Rate).
+					Err(err).
+					Msg("Error parsing rate")
+				c.unknown("Error parsing rate "+rule.Rate+" for rule "+rulename+" in search "+actions.Actions[i].location())
+				return nil, err
+			}
+			if r.MaxGroups == 0 {
+				r.MaxGroups = 10
+			}
+			if r.DistinctLimit == 0 {
+				r.DistinctLimit = 10000
+			}
+			if r.DistinctField != "" && r.ValueField != "" {
+				err = errors.New("distinct_field and value_field are mutually exclusive")
+				logger.Error().Str("id", "ERR20000006").Err(err).Msg("Invalid rule")
+				c.unknown("Rule "+rulename+" in search "+actions.Actions[i].location()+" uses distinct_field and value_field")
+				return nil, err
+			}
+			r.statistic, r.quantile, err = parseStatistic(rule.Statistic)
+			if err != nil {
+				logger.Error().Str("id", "ERR20000007").
+					Str("statistic", rule.Statistic).
+					Err(err).
+					Msg("Error parsing statistic")
+				c.unknown("Error parsing statistic "+rule.Statistic+" for rule "+rulename+" in search "+actions.Actions[i].location())
+				return nil, err
+			}
+			err = r.initType()
+			if err != nil {
+				logger.Error().Str("id", "ERR20000008").
+					Str("type", rule.Type).
+					Err(err).
+					Msg("Invalid rule type configuration")
+				c.unknown("Invalid configuration for rule "+rulename+" in search "+actions.Actions[i].location()+": "+err.Error())
+				return nil, err
+			}
+			err = r.initBaseline()
+			if err != nil {
+				logger.Error().Str("id", "ERR20000005").
+					Str("baseline_warmup", rule.BaselineWarmup).
+					Err(err).
+					Msg("Error parsing baseline warm-up period")
+				c.unknown("Error parsing baseline warm-up period "+rule.BaselineWarmup+" for rule "+rulename+" in search "+actions.Actions[i].location())
+				return nil, err
+			}
+			err = r.initDedupe()
+			if err != nil {
+				logger.Error().Str("id", "ERR20000009").
+					Str("dedupe_window", rule.DedupeWindow).
+					Err(err).
+					Msg("Error parsing dedupe window")
+				c.unknown("Error parsing dedupe window "+rule.DedupeWindow+" for rule "+rulename+" in search "+actions.Actions[i].location())
+				return nil, err
+			}
+			err = r.Maintenance.init()
+			if err != nil {
+				logger.Error().Str("id", "ERR20000010").Err(err).Msg("Invalid maintenance window")
+				c.unknown("Invalid configuration for rule "+rulename+" in search "+actions.Actions[i].location()+": "+err.Error())
 				return nil, err
 			}
 			actions.Actions[i].Rules[rulename] = r
 			o = o.Append(rulename,r.Order)
 		}
+		err = actions.Actions[i].Maintenance.init()
+		if err != nil {
+			logger.Error().Str("id", "ERR20000011").Str("search", actions.Actions[i].Name).Str("file", actions.Actions[i].sourceFile).Err(err).Msg("Invalid maintenance window")
+			c.unknown("Invalid configuration for search "+actions.Actions[i].location()+": "+err.Error())
+			return nil, err
+		}
 		actions.Actions[i].results = actions.Actions[i].newRulecount()
 		actions.Actions[i].orderedRules = o.Sort()
 	}
@@ -82,27 +159,50 @@ func NewCheck(ActionsFile string, Connection *elasticsearch.Elasticsearch, Nagio
 	return c, nil
 }
 
-// Read the actions data from the provided actions file
+// Read the actions data from the provided action file or from all action
+// files in the provided directory, including the files they include
 func readActionFile(ActionFile string) (*Actions, error) {
-	var actions *Actions
-	logger := log.With().Str("func", "readActionFile").Str("package", "check").Logger()
+	logger := log.With().Str("func", "readActionFile").Str("package", "check").Str("filename", ActionFile).Logger()
 	logger.Trace().Msg("Enter func")
 
-	logger.Debug().Str("id", "DBG20010001").Str("filename", ActionFile).Msg("Read action file")
-	f, err := ioutil.ReadFile(ActionFile)
+	files, err := actionFiles(ActionFile)
 	if err != nil {
-		logger.Fatal().Str("id", "ERR20010001").Err(err).Str("filename", ActionFile).Msg("Failed to read action file")
+		logger.Error().Str("id", "ERR20010001").Err(err).Msg("Failed to read action file")
 		return nil, err
 	}
-	actions = new(Actions)
-	err = yaml.Unmarshal(f, actions)
+	l := &actionFileLoader{seen: make(map[string]bool)}
+	for _, file := range files {
+		err = l.load(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	actions, err := l.actions()
 	if err != nil {
-		log.Fatal().Str("id", "ERR20010002").Str("file", ActionFile).Err(err).Msg("Error unmarshalling yaml config file")
+		logger.Error().Str("id", "ERR20010003").Err(err).Msg("Error reading actions")
 		return nil, err
 	}
 	return actions, nil
 }
 
+// Replays the time range between From and To instead of continuing at the
+// timestamp in the status files. Like a dry run, the status files are not
+// saved. Additionally, no history entries are created and the unhandled
+// entries in the status files are not reported, so a replay only shows the
+// results for the time range. Only the baselines and snoozes are taken from
+// the status files, the known values, templates, open sequences and dedupe
+// keys start empty as they were learned after the replayed time range.
+func (c *Check) Replay(From time.Time, To time.Time) {
+	c.replay = true
+	c.replayFrom = From
+	c.replayTo = To
+}
+
+// Returns true, if the status files must not be saved
+func (c *Check) readOnly() bool {
+	return c.DryRun || c.replay
+}
+
 // Execute all Actions listed in the Actions parameter. If it is empty, all
 // actions are executed
 func (c *Check) Execute(Actions []string) error {
@@ -124,69 +224,37 @@ func (c *Check) Execute(Actions []string) error {
 				Str("filename", a.StatusFile).
 				Err(err).
 				Msg("Error reading statusfile")
-			c.nagios.AddResult(nagiosplugin.UNKNOWN, "Error reading timestamp from "+a.StatusFile)
+			c.unknown("Error reading timestamp from "+a.StatusFile)
 			return err
 		}
+		if c.replay {
+			s = &StatusData{
+				Timestamp: formatTimestamp(c.replayFrom),
+				Baselines: s.Baselines,
+				Snoozes:   s.Snoozes,
+			}
+			c.actions.Actions[ac].replay = true
+			c.actions.Actions[ac].evaluatedAt = c.replayTo
+		}
 		c.actions.Actions[ac].StatusData = s
+		c.actions.Actions[ac].last_timestamp = s.Timestamp
 		timestamp := s.Timestamp
 
-		logger.Debug().Str("id", "DBG20020001").Str("timestamp", timestamp).Msg("Run search")
+		logger.Debug().Str("id", "DBG20020001").Str("timestamp", timestamp).Bool("replay", c.replay).Msg("Run search")
 		q := strings.ReplaceAll(a.Query, "_TIMESTAMP_", timestamp)
-		pagination, err := c.connection.StartPaginatedSearch(a.Index, q)
-		if err != nil {
-			reason := ""
-			if pagination != nil {
-				if len(pagination.Results) > 0 {
-					reason = pagination.Results[0].Error.Reason
-				}
+		if c.replay {
+			q, err = limitQuery(q, c.replayTo)
+			if err != nil {
+				logger.Error().Str("id", "ERR20020004").Err(err).Msg("Could not add time range to query")
+				c.unknown("Could not add the time range to the query of search " + a.Name + ": " + err.Error())
+				return err
 			}
-			logger.Error().Str("id", "ERR20020001").
-				Str("timestamp", timestamp).
-				Str("parsed_query", q).
-				Int("page", 0).
-				Str("reason", reason).
-				Err(err).
-				Msg("Could not run search '" + a.Name + "'")
-			c.nagios.AddResult(nagiosplugin.UNKNOWN, fmt.Sprintf("%v. Could not initiate paginated search %v on index %v. Query is %v", err, a.Name, a.Index, a.Query))
-			return err
 		}
-		timestamp, err = a.countResults(pagination.Results[0])
+		err = c.search(ac, q, c.actions.Actions[ac].countResults)
 		if err != nil {
 			return err
 		}
-		c.actions.Actions[ac].StatusData.Timestamp = timestamp
-		hc := len(pagination.Results[0].Hits.Hits)
-		if hc < int(pagination.Pagination.Size) {
-			logger.Info().Str("id", "INF20020001").Int("page", 0).Int("hits", hc).Str("timestamp", timestamp).Msg("Only page")
-			break
-		}
-		logger.Info().Str("id", "INF20020001").Int("page", 0).Int("hits", hc).Str("timestamp", timestamp).Msg("First page")
-		defer pagination.Close()
-		for page := 0; page < int(a.Limit-1); page++ {
-			err = pagination.Next()
-			if err != nil {
-				logger.Error().Str("id", "ERR20020002").
-					Str("timestamp", timestamp).
-					Str("parsed_query", q).
-					Int("page", page).
-					Str("reason", pagination.Results[len(pagination.Results)-1].Error.Reason).
-					Err(err).
-					Msg("Could not run paginated '" + a.Name + "'")
-				c.nagios.AddResult(nagiosplugin.UNKNOWN, fmt.Sprintf("%v. Could not run paginated search %v #%v on index %v. Query is %v", err, a.Name, page, a.Index, a.Query))
-				return err
-			}
-			timestamp, err = a.countResults(pagination.Results[len(pagination.Results)-1])
-			if err != nil {
-				return err
-			}
-			c.actions.Actions[ac].StatusData.Timestamp = timestamp
-			hc := len(pagination.Results[len(pagination.Results)-1].Hits.Hits)
-			if hc < int(pagination.Pagination.Size) {
-				logger.Info().Str("id", "INF20020001").Int("page", page).Int("hits", hc).Str("timestamp", timestamp).Msg("Last page")
-				break
-			}
-			logger.Info().Str("id", "INF20020001").Int("page", page).Int("hits", hc).Str("timestamp", timestamp).Msg("Next page")
-		}
+		c.actions.Actions[ac].finishRun()
 	}
 	if !found {
 		arr := zerolog.Arr()
@@ -198,12 +266,97 @@ func (c *Check) Execute(Actions []string) error {
 			Array("actions", arr).
 			Str("file", c.actionsFile).
 			Msg("None of the actions were found in the action file")
-		c.nagios.AddResult(nagiosplugin.UNKNOWN, fmt.Sprintf("None of the actions %v were found in the action file %v", Actions, c.actionsFile))
+		c.unknown(fmt.Sprintf("None of the actions %v were found in the action file %v", Actions, c.actionsFile))
 	}
 	c.outputAll(Actions)
 	return nil
 }
 
+// Runs the paginated search with the query Q for the action with the index
+// AC and passes every page to Process, which returns the timestamp of the last
+// hit. The search stops after the last page or when the limit of pages for the
+// action is reached. As a replay is not continued by the next run, a note is
+// added to the long output, if the limit cut it short.
+func (c *Check) search(ac int, q string, Process func(*elasticsearch.ElasticsearchResult) (string, error)) error {
+	a := c.actions.Actions[ac]
+	logger := log.With().Str("func", "Check.search").Str("package", "check").Str("name", a.Name).Str("index", a.Index).Logger()
+	logger.Trace().Msg("Enter func")
+	timestamp := a.StatusData.Timestamp
+	pagination, err := c.connection.StartPaginatedSearch(a.Index, q)
+	if err != nil {
+		reason := ""
+		if pagination != nil {
+			if len(pagination.Results) > 0 {
+				reason = pagination.Results[0].Error.Reason
+			}
+		}
+		logger.Error().Str("id", "ERR20020001").
+			Str("timestamp", timestamp).
+			Str("parsed_query", q).
+			Int("page", 0).
+			Str("reason", reason).
+			Err(err).
+			Msg("Could not run search '" + a.Name + "'")
+		c.unknown(fmt.Sprintf("%v. Could not initiate paginated search %v on index %v. Query is %v", err, a.Name, a.Index, a.Query))
+		return err
+	}
+	timestamp, err = Process(pagination.Results[0])
+	if err != nil {
+		return err
+	}
+	c.actions.Actions[ac].setTimestamp(timestamp)
+	hc := len(pagination.Results[0].Hits.Hits)
+	if hc < int(pagination.Pagination.Size) {
+		logger.Info().Str("id", "INF20020001").Int("page", 0).Int("hits", hc).Str("timestamp", timestamp).Msg("Only page")
+		pagination.Close()
+		return nil
+	}
+	logger.Info().Str("id", "INF20020001").Int("page", 0).Int("hits", hc).Str("timestamp", timestamp).Msg("First page")
+	defer pagination.Close()
+	complete := false
+	for page := 0; page < int(a.Limit-1); page++ {
+		err = pagination.Next()
+		if err != nil {
+			logger.Error().Str("id", "ERR20020002").
+				Str("timestamp", timestamp).
+				Str("parsed_query", q).
+				Int("page", page).
+				Str("reason", pagination.Results[len(pagination.Results)-1].Error.Reason).
+				Err(err).
+				Msg("Could not run paginated '" + a.Name + "'")
+			c.unknown(fmt.Sprintf("%v. Could not run paginated search %v #%v on index %v. Query is %v", err, a.Name, page, a.Index, a.Query))
+			return err
+		}
+		timestamp, err = Process(pagination.Results[len(pagination.Results)-1])
+		if err != nil {
+			return err
+		}
+		c.actions.Actions[ac].setTimestamp(timestamp)
+		hc := len(pagination.Results[len(pagination.Results)-1].Hits.Hits)
+		if hc < int(pagination.Pagination.Size) {
+			logger.Info().Str("id", "INF20020001").Int("page", page).Int("hits", hc).Str("timestamp", timestamp).Msg("Last page")
+			complete = true
+			break
+		}
+		logger.Info().Str("id", "INF20020001").Int("page", page).Int("hits", hc).Str("timestamp", timestamp).Msg("Next page")
+	}
+	if !complete && c.replay {
+		logger.Warn().Str("id", "WRN20020001").Uint64("limit", uint64(a.Limit)).Str("timestamp", timestamp).Msg("Replay stopped at the page limit")
+		if c.nagios != nil {
+			c.nagios.AddLongPluginOutput(fmt.Sprintf("Replay of search %v stopped after %v pages at %v, the rest of the time range was not evaluated", a.Name, a.Limit, timestamp))
+		}
+	}
+	return nil
+}
+
+// Adds an UNKNOWN result to the nagios object, if there is one. Commands
+// which are not run by Nagios/Icinga2 don't have one.
+func (c *Check) unknown(Message string) {
+	if c.nagios != nil {
+		c.nagios.AddResult(nagiosplugin.UNKNOWN, Message)
+	}
+}
+
 // Little helper looking if the action is in the given list. Also returns true,
 // if the list is empty
 func actionInList(action string, list []string) bool {
@@ -234,10 +387,21 @@ func (c *Check) outputAll(Actions []string) error {
 		if a.History > 0 {
 			c.actions.Actions[i].StatusData.Prune(a.History)
 		}
+		c.actions.Actions[i].StatusData.PruneSnoozes(time.Now())
+		if c.readOnly() {
+			a.outputResults(c.nagios, "")
+			if c.replay {
+				c.nagios.AddLongPluginOutput(fmt.Sprintf("Replay of search %v from %v to %v, the status file %v was not changed", a.Name, formatTimestamp(c.replayFrom), formatTimestamp(c.replayTo), a.StatusFile))
+			} else {
+				c.nagios.AddLongPluginOutput(fmt.Sprintf("Dry run of search %v, the status file %v was not changed", a.Name, a.StatusFile))
+			}
+			logger.Info().Str("id", "INF20120001").Str("name", a.Name).Str("filename", a.StatusFile).Bool("replay", c.replay).Msg("Not saving status file")
+			continue
+		}
 		a.outputResults(c.nagios, c.Command)
 		err := c.actions.Actions[i].StatusData.Save(a.StatusFile)
 		if err != nil {
-			c.nagios.AddResult(nagiosplugin.UNKNOWN, fmt.Sprintf("Could not save last timestamp %v to %v, error %v", a.StatusData.Timestamp, a.StatusFile, err))
+			c.unknown(fmt.Sprintf("Could not save last timestamp %v to %v, error %v", a.StatusData.Timestamp, a.StatusFile, err))
 			return err
 		}
 	}
@@ -261,8 +425,9 @@ func (c *Check) GetAction(Name string) (Action, error) {
 // This sets the "handled" flag for a list of historic events. The Actions
 // parameter specifies the actions to look for, if it is empty, all actions will
 // be checked. The parameter Uuids is a list of all the historic events to
-// change.
-func (c *Check) HandleHistory(Actions []string, Uuids []string, All bool) error {
+// change. Ack records who changed the events and why, if Ack.Handled is
+// false, the events are set back to "not handled".
+func (c *Check) HandleHistory(Actions []string, Uuids []string, All bool, Ack Acknowledgement) error {
 	logger := log.With().Str("func", "ClearHistory").Str("package", "check").Logger()
 	logger.Trace().Msg("Enter func")
 	for _, a := range c.actions.Actions {
@@ -279,7 +444,7 @@ func (c *Check) HandleHistory(Actions []string, Uuids []string, All bool) error
 			log.Error().Str("id", "ERR20120001").Str("filename", a.StatusFile).Err(err).Msg("Could not read status file")
 			return err
 		}
-		s.HandleHistoryEntry(Uuids, All)
+		s.HandleHistoryEntry(Uuids, All, Ack)
 		err = s.Save(a.StatusFile)
 		if err != nil {
 			return err
@@ -337,8 +502,9 @@ func (c *Check) ListHistory(Actions []string, HighlightUuid bool) error {
 			log.Error().Str("id", "ERR20130001").Str("filename", a.StatusFile).Err(err).Msg("Could not read status file")
 			return err
 		}
-		fmt.Println(a.Name)
+		fmt.Printf("%v (%v)\n", a.Name, a.sourceFile)
 		s.PrintHistory("", true, "", HighlightUuid, c.Command)
+		s.PrintSnoozes(time.Now())
 	}
 	return nil
 }
@@ -0,0 +1,124 @@
+package check
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+)
+
+// Parses the dedupe window of the rule. Without a window, hits are only
+// deduplicated within a single run.
+func (rule *Rule) initDedupe() error {
+	var err error
+	if len(rule.DedupeKey) == 0 || rule.DedupeWindow == "" {
+		return nil
+	}
+	rule.dedupeWindow, err = time.ParseDuration(rule.DedupeWindow)
+	return err
+}
+
+// Returns the deduplication key of the hit for the rule. A single field is
+// used as it is, the values of multiple fields are hashed. Returns false, if
+// the rule doesn't use deduplication or the hit lacks one of the fields.
+func (rule Rule) dedupeKey(Hit elasticsearch.HitElement) (string, bool) {
+	if len(rule.DedupeKey) == 0 {
+		return "", false
+	}
+	values := make([]string, len(rule.DedupeKey))
+	for i, field := range rule.DedupeKey {
+		v, ok := Hit.GetValue(field)
+		if !ok {
+			return "", false
+		}
+		values[i] = fmt.Sprintf("%v", v)
+	}
+	if len(values) == 1 {
+		return values[0], true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(values, "\x00")))
+	return fmt.Sprintf("%016x", h.Sum64()), true
+}
+
+// Returns the keys seen for a rule using dedupe_key with the timestamp of the
+// hit, when they were seen last.
+func (status *StatusData) DedupeKeys(Rule string) map[string]string {
+	if status.Dedupe == nil {
+		status.Dedupe = make(map[string]map[string]string)
+	}
+	k, ok := status.Dedupe[Rule]
+	if !ok {
+		k = make(map[string]string)
+		status.Dedupe[Rule] = k
+	}
+	return k
+}
+
+// Checks, if a hit is a duplicate of a hit already counted for the rule. If
+// it is, it is counted as a duplicate. Returns the key of the hit, which has
+// to be passed to seen once the hit matched the rule, and true for a duplicate.
+func (a Action) isDuplicate(rulename string, rule Rule, hit elasticsearch.ElasticsearchHitList) (string, bool) {
+	logger := log.With().Str("func", "Action.isDuplicate").Str("package", "check").Str("rule", rulename).Str("document_id", hit.Id).Logger()
+	logger.Trace().Msg("Enter func")
+	key, ok := rule.dedupeKey(hit.Fields)
+	if !ok {
+		return "", false
+	}
+	seen, ok := a.StatusData.DedupeKeys(rulename)[key]
+	if !ok {
+		return key, false
+	}
+	ts, err := getTimestamp(hit, "@timestamp")
+	if err == nil && rule.dedupeWindow > 0 && sequenceExpired(seen, ts, rule.dedupeWindow) {
+		return key, false
+	}
+	logger.Debug().Str("id", "DBG20190001").Str("key", key).Str("seen", seen).Msg("Skipping duplicate hit")
+	entry := a.results[rulename]
+	entry.Duplicates++
+	a.results[rulename] = entry
+	return key, true
+}
+
+// Remembers the key of a hit counted for the rule.
+func (a Action) seen(rulename string, key string, hit elasticsearch.ElasticsearchHitList) {
+	if key == "" {
+		return
+	}
+	ts, err := getTimestamp(hit, "@timestamp")
+	if err != nil {
+		return
+	}
+	a.StatusData.DedupeKeys(rulename)[key] = ts
+}
+
+// Forgets the keys which are older than the dedupe window of their rule. Keys
+// of rules without a window are only kept during a single run. This is called
+// at the end of every run.
+func (a Action) expireDedupeKeys(Now time.Time) {
+	logger := log.With().Str("func", "Action.expireDedupeKeys").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	now := Now.UTC().Format(time.RFC3339Nano)
+	for rulename, rule := range a.Rules {
+		if len(rule.DedupeKey) == 0 {
+			continue
+		}
+		if rule.dedupeWindow == 0 {
+			delete(a.StatusData.Dedupe, rulename)
+			continue
+		}
+		keys := a.StatusData.DedupeKeys(rulename)
+		for k, seen := range keys {
+			if sequenceExpired(seen, now, rule.dedupeWindow) {
+				delete(keys, k)
+			}
+		}
+		logger.Debug().Str("id", "DBG20190002").Str("rule", rulename).Int("keys", len(keys)).Msg("Expired dedupe keys")
+	}
+	if len(a.StatusData.Dedupe) == 0 {
+		a.StatusData.Dedupe = nil
+	}
+}
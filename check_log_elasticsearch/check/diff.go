@@ -0,0 +1,240 @@
+package check
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/joernott/nagiosplugin/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// The documents to compare the rules of two action files with. Either the
+// documents read from an NDJSON file are used for all actions or the
+// documents are queried from Elasticsearch per action for the time range
+// between From and To.
+type DiffSource struct {
+	Documents []testDocument // Documents read from a file
+	From      time.Time      // Start of the time range to query
+	To        time.Time      // End of the time range to query
+}
+
+// Reads the documents for the comparison from an NDJSON file
+func NewDiffSource(Input io.Reader, Name string) (*DiffSource, error) {
+	documents, err := readDocuments(Input, Name)
+	if err != nil {
+		return nil, err
+	}
+	return &DiffSource{Documents: documents}, nil
+}
+
+// The evaluation of the documents by one version of an action
+type diffSide struct {
+	action      Action
+	evaluations map[string]HitEvaluation
+	documents   int
+	state       string
+}
+
+// Queries the documents of the action with the given index for the time
+// range between From and To
+func (c *Check) fetchDocuments(ac int, From time.Time, To time.Time) ([]testDocument, error) {
+	logger := log.With().Str("func", "Check.fetchDocuments").Str("package", "check").Str("action", c.actions.Actions[ac].Name).Logger()
+	logger.Trace().Msg("Enter func")
+	a := &c.actions.Actions[ac]
+	a.StatusData = new(StatusData)
+	q, err := limitQuery(strings.ReplaceAll(a.Query, "_TIMESTAMP_", formatTimestamp(From)), To)
+	if err != nil {
+		logger.Error().Str("id", "ERR20260001").Str("query", a.Query).Err(err).Msg("Could not add time range to query")
+		return nil, err
+	}
+	var documents []testDocument
+	err = c.search(ac, q, func(result *elasticsearch.ElasticsearchResult) (string, error) {
+		last := ""
+		for _, hit := range result.Hits.Hits {
+			documents = append(documents, testDocument{line: len(documents) + 1, hit: hit})
+			last = hitTimestamp(hit)
+		}
+		return last, nil
+	})
+	logger.Debug().Str("id", "DBG20260001").Int("documents", len(documents)).Msg("Fetched documents")
+	return documents, err
+}
+
+// Runs the documents through a copy of the action with an empty status and
+// returns the evaluations by document id together with the resulting Nagios
+// state
+func (c *Check) evaluateSide(ac int, Source *DiffSource) (*diffSide, error) {
+	documents := Source.Documents
+	if documents == nil {
+		var err error
+		documents, err = c.fetchDocuments(ac, Source.From, Source.To)
+		if err != nil {
+			return nil, err
+		}
+	}
+	side := &diffSide{action: c.actions.Actions[ac].offline(), evaluations: make(map[string]HitEvaluation), documents: len(documents)}
+	evaluations, err := side.action.evaluateDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range evaluations {
+		side.evaluations[e.Id] = e
+	}
+	nagios := nagiosplugin.NewCheck()
+	side.action.outputResults(nagios, "")
+	side.state = strings.SplitN(nagios.String(), ":", 2)[0]
+	return side, nil
+}
+
+// Returns the index of the action with the given name or -1
+func (c *Check) actionIndex(Name string) int {
+	for i, a := range c.actions.Actions {
+		if a.Name == Name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Compares the rules of the actions of this check (the old action file) with
+// the rules of the actions of New (the new action file) by evaluating the
+// documents of Source with both. For every action, the differences of the
+// counts per rule, the documents counted for other rules and the Nagios state
+// are printed. At most Top documents are listed per action, 0 lists all.
+// Returns true, if the Nagios state of one of the actions changes or an action
+// only exists in one of the files.
+func (c *Check) Diff(New *Check, Actions []string, Source *DiffSource, Top int) (bool, error) {
+	logger := log.With().Str("func", "Check.Diff").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	var names []string
+	for _, a := range append(append([]Action{}, c.actions.Actions...), New.actions.Actions...) {
+		if actionInList(a.Name, Actions) && !stringInList(a.Name, names) {
+			names = append(names, a.Name)
+		}
+	}
+	changed := false
+	for _, name := range names {
+		oldIndex := c.actionIndex(name)
+		newIndex := New.actionIndex(name)
+		if oldIndex < 0 || newIndex < 0 {
+			where := "new"
+			if newIndex < 0 {
+				where = "old"
+			}
+			fmt.Printf("Action %v: only in the %v action file\n\n", name, where)
+			changed = true
+			continue
+		}
+		oldSide, err := c.evaluateSide(oldIndex, Source)
+		if err != nil {
+			return changed, err
+		}
+		newSide, err := New.evaluateSide(newIndex, Source)
+		if err != nil {
+			return changed, err
+		}
+		if printDiff(name, oldSide, newSide, Top) {
+			changed = true
+		}
+		logger.Debug().Str("id", "DBG20260002").Str("action", name).Str("old_state", oldSide.state).Str("new_state", newSide.state).Msg("Compared action")
+	}
+	return changed, nil
+}
+
+// Little helper looking if a string is in the list
+func stringInList(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Prints the differences between the old and the new evaluation of an action.
+// Returns true, if the Nagios state changes.
+func printDiff(Name string, Old *diffSide, New *diffSide, Top int) bool {
+	fmt.Printf("Action %v: %v documents (old), %v documents (new)\n", Name, Old.documents, New.documents)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "rule\told\tnew\tdiff\t")
+	var rules []string
+	for _, r := range append(append(OrderedRuleList{}, Old.action.orderedRules...), New.action.orderedRules...) {
+		rulename, _ := r.Get(nil)
+		if !stringInList(rulename, rules) {
+			rules = append(rules, rulename)
+		}
+	}
+	for _, rulename := range append(rules, "_nomatch", "_total") {
+		label := rulename
+		switch rulename {
+		case "_nomatch":
+			label = "not matched"
+		case "_total":
+			label = "total"
+		}
+		oldEntry, inOld := Old.action.results[rulename]
+		newEntry, inNew := New.action.results[rulename]
+		oldCount, newCount := "-", "-"
+		if inOld {
+			oldCount = fmt.Sprintf("%v", oldEntry.Count)
+		}
+		if inNew {
+			newCount = fmt.Sprintf("%v", newEntry.Count)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%+d\t\n", label, oldCount, newCount, int64(newEntry.Count)-int64(oldEntry.Count))
+	}
+	w.Flush()
+
+	var ids []string
+	for id := range Old.evaluations {
+		ids = append(ids, id)
+	}
+	for id := range New.evaluations {
+		if _, ok := Old.evaluations[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var changes []string
+	for _, id := range ids {
+		o, inOld := Old.evaluations[id]
+		n, inNew := New.evaluations[id]
+		before, after := "(not queried)", "(not queried)"
+		if inOld {
+			before = ruleList(sortedMatches(o))
+		}
+		if inNew {
+			after = ruleList(sortedMatches(n))
+		}
+		if before != after {
+			changes = append(changes, fmt.Sprintf("  %v: %v -> %v", id, before, after))
+		}
+	}
+	fmt.Printf("Documents counted for other rules: %v\n", len(changes))
+	for i, change := range changes {
+		if Top > 0 && i >= Top {
+			fmt.Printf("  ... %v more\n", len(changes)-Top)
+			break
+		}
+		fmt.Println(change)
+	}
+	if Old.state == New.state {
+		fmt.Printf("Nagios state: %v (unchanged)\n\n", Old.state)
+		return false
+	}
+	fmt.Printf("Nagios state: %v -> %v\n\n", Old.state, New.state)
+	return true
+}
+
+// Returns the rules a hit was counted for in sorted order
+func sortedMatches(e HitEvaluation) []string {
+	matches := e.Matches()
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,145 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+)
+
+// The result of checking a single pattern or exclude against a hit
+type PatternResult struct {
+	Field string // Name of the field
+	Regex string // The regular expression
+	Value string // Value of the field in the hit
+	Found bool   // False, if the hit doesn't contain the field
+	Match bool   // True, if the regular expression matched the value
+}
+
+// The evaluation of one rule for a hit
+type RuleEvaluation struct {
+	Name      string          // Name of the rule
+	Rule      Rule            // The rule itself
+	Patterns  []PatternResult // Results of all patterns of the rule
+	Excludes  []PatternResult // Results of all exclude patterns of the rule
+	Decision  *PatternResult  // The pattern or exclude deciding the result, if there is one
+	Excluded  bool            // True, if the decision was made by an exclude
+	Match     bool            // True, if the hit was counted for the rule
+	Duplicate bool            // True, if the hit was only counted as duplicate
+	Skipped   bool            // True, if the rule wasn't applied because a previous rule matched with stop_on_match
+}
+
+// The evaluation of all rules of an action for a hit in the order of the
+// rules
+type HitEvaluation struct {
+	Id    string           // Id of the document
+	Rules []RuleEvaluation // Evaluations of the rules
+}
+
+// Returns the names of the rules the hit was counted for
+func (e HitEvaluation) Matches() []string {
+	var matches []string
+	for _, r := range e.Rules {
+		if r.Match {
+			matches = append(matches, r.Name)
+		}
+	}
+	return matches
+}
+
+// Checks a single pattern against a hit
+func explainPattern(Hit elasticsearch.HitElement, p Pattern) (PatternResult, error) {
+	result := PatternResult{Field: p.Field, Regex: p.Regex}
+	result.Value, result.Found = Hit.GetString(p.Field)
+	if !result.Found {
+		result.Value = ""
+		return result, nil
+	}
+	match, err := regexp.MatchString(p.Regex, result.Value)
+	result.Match = match
+	return result, err
+}
+
+// Checks all patterns and excludes of the rule against the hit and finds the
+// one deciding the result the same way isMatch does: Without use_and, the
+// first matching pattern decides, with use_and the first pattern not matching.
+// If the patterns match, the first matching exclude decides.
+func (rule Rule) explainMatch(Hit elasticsearch.HitElement, Evaluation *RuleEvaluation) error {
+	for _, p := range rule.Pattern {
+		result, err := explainPattern(Hit, p)
+		if err != nil {
+			return err
+		}
+		Evaluation.Patterns = append(Evaluation.Patterns, result)
+	}
+	for _, e := range rule.Exclude {
+		result, err := explainPattern(Hit, e)
+		if err != nil {
+			return err
+		}
+		Evaluation.Excludes = append(Evaluation.Excludes, result)
+	}
+	found := len(Evaluation.Patterns) > 0 && rule.UseAnd
+	for i, p := range Evaluation.Patterns {
+		if rule.UseAnd && !p.Match {
+			found = false
+			Evaluation.Decision = &Evaluation.Patterns[i]
+			break
+		}
+		if !rule.UseAnd && p.Match {
+			found = true
+			Evaluation.Decision = &Evaluation.Patterns[i]
+			break
+		}
+	}
+	// Rules of type new_value and template match all hits without patterns
+	if len(rule.Pattern) == 0 && (rule.Type == ruleTypeNewValue || rule.Type == ruleTypeTemplate) {
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	for i, e := range Evaluation.Excludes {
+		if e.Match {
+			Evaluation.Decision = &Evaluation.Excludes[i]
+			Evaluation.Excluded = true
+			break
+		}
+	}
+	return nil
+}
+
+// Describes the pattern result, e.g. message =~ /error/ on "an error"
+func (p PatternResult) String() string {
+	if !p.Found {
+		return fmt.Sprintf("%v =~ /%v/ (field missing)", p.Field, p.Regex)
+	}
+	return fmt.Sprintf("%v =~ /%v/ on %q", p.Field, p.Regex, p.Value)
+}
+
+// Describes the result of the rule and the reason for it in one line
+func (e RuleEvaluation) String() string {
+	switch {
+	case e.Skipped:
+		return "skipped, a previous rule matched with stop_on_match"
+	case e.Duplicate:
+		return "duplicate of a hit already counted"
+	case e.Excluded:
+		return "excluded by " + e.Decision.String()
+	case e.Match && e.Decision != nil:
+		return "match by " + e.Decision.String()
+	case e.Match && e.Rule.UseAnd && len(e.Patterns) > 0:
+		return fmt.Sprintf("match, all %v patterns matched", len(e.Patterns))
+	case e.Match:
+		return "match"
+	case e.Decision != nil && e.Rule.UseAnd:
+		return "no match, failed " + e.Decision.String()
+	case len(e.Patterns) > 0 && e.Rule.Type != ruleTypeCount && e.Rule.Type != "":
+		return "no match by the " + e.Rule.Type + " rule"
+	case len(e.Patterns) > 0:
+		return "no match, none of the patterns matched"
+	case e.Rule.Type != ruleTypeCount && e.Rule.Type != "":
+		return "no match by the " + e.Rule.Type + " rule"
+	}
+	return "no match, the rule has no patterns"
+}
@@ -0,0 +1,203 @@
+package check
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+)
+
+// Parts of the query of an action, which are kept for fetching a single
+// document, so the document has the same fields as during the check
+var explainQueryKeys = []string{"fields", "_source", "docvalue_fields", "stored_fields", "runtime_mappings"}
+
+// Builds the query fetching the document with the given id from the query
+// of the action. Numbers in the kept parts are not converted to float64.
+func explainQuery(Query string, Id string) (string, error) {
+	const placeholder = `"_pagination_":0`
+	q := strings.Replace(strings.ReplaceAll(Query, "_TIMESTAMP_", "1900-01-01T00:00:00.000Z"), "_PAGINATION_", placeholder, 1)
+	var action map[string]interface{}
+	d := json.NewDecoder(strings.NewReader(q))
+	d.UseNumber()
+	err := d.Decode(&action)
+	if err != nil {
+		return "", err
+	}
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": []string{Id}},
+		},
+		"size": 1,
+	}
+	for _, key := range explainQueryKeys {
+		if v, ok := action[key]; ok {
+			body[key] = v
+		}
+	}
+	b, err := json.Marshal(body)
+	return string(b), err
+}
+
+// Fetches the document with the given id from Elasticsearch. Index overrides
+// the index of the action.
+func (c *Check) fetchDocument(a Action, Id string, Index string) (elasticsearch.ElasticsearchHitList, error) {
+	logger := log.With().Str("func", "Check.fetchDocument").Str("package", "check").Str("action", a.Name).Str("document_id", Id).Logger()
+	logger.Trace().Msg("Enter func")
+	if Index == "" {
+		Index = a.Index
+	}
+	q, err := explainQuery(a.Query, Id)
+	if err != nil {
+		logger.Error().Str("id", "ERR20270001").Str("query", a.Query).Err(err).Msg("Could not build query for the document")
+		return elasticsearch.ElasticsearchHitList{}, err
+	}
+	result, err := c.connection.Search(Index, q)
+	if err != nil {
+		logger.Error().Str("id", "ERR20270002").Str("index", Index).Err(err).Msg("Could not fetch document")
+		return elasticsearch.ElasticsearchHitList{}, err
+	}
+	if result.Error.Reason != "" {
+		err = errors.New(result.Error.Reason)
+		logger.Error().Str("id", "ERR20270003").Str("index", Index).Err(err).Msg("Search for the document failed")
+		return elasticsearch.ElasticsearchHitList{}, err
+	}
+	for _, hit := range result.Hits.Hits {
+		if hit.Id == Id {
+			return hit, nil
+		}
+	}
+	err = fmt.Errorf("Document %v not found in index %v", Id, Index)
+	logger.Error().Str("id", "ERR20270004").Str("index", Index).Err(err).Msg("Document not found")
+	return elasticsearch.ElasticsearchHitList{}, err
+}
+
+// Fetches a single document from Elasticsearch and prints how the rules of
+// the action evaluate it: the values of the fields used by the rules, the
+// result of every pattern and exclude and the effect of use_and and
+// stop_on_match in the order of the rules. Index overrides the index of the
+// action. The rules start with an empty status, which is not saved.
+func (c *Check) Explain(ActionName string, Id string, Index string) error {
+	logger := log.With().Str("func", "Check.Explain").Str("package", "check").Str("action", ActionName).Str("document_id", Id).Logger()
+	logger.Trace().Msg("Enter func")
+	action, err := c.GetAction(ActionName)
+	if err != nil {
+		return err
+	}
+	hit, err := c.fetchDocument(action, Id, Index)
+	if err != nil {
+		return err
+	}
+	a := action.offline()
+	evaluations, err := a.evaluateDocuments([]testDocument{{line: 1, hit: hit}})
+	if err != nil {
+		return err
+	}
+	e := evaluations[0]
+	fmt.Printf("Document %v in index %v, action %v\n", hit.Id, hit.Index, a.Name)
+	fmt.Println("Fields used by the rules:")
+	for _, field := range a.ruleFields() {
+		value, ok := hit.Fields.GetString(field)
+		if !ok {
+			value = "(missing)"
+		}
+		fmt.Printf("  %v: %v\n", field, value)
+	}
+	fmt.Println("Rules in the order of evaluation:")
+	for i, r := range e.Rules {
+		printRuleEvaluation(i+1, r)
+	}
+	fmt.Printf("Result: %v\n", explainResult(e))
+	logger.Debug().Str("id", "DBG20270001").Strs("matches", e.Matches()).Msg("Explained document")
+	return nil
+}
+
+// Returns the fields used by the rules of the action in sorted order
+func (a Action) ruleFields() []string {
+	var fields []string
+	add := func(Fields ...string) {
+		for _, f := range Fields {
+			if f != "" && !stringInList(f, fields) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	for _, rule := range a.Rules {
+		for _, p := range rule.patterns() {
+			add(p.Field)
+		}
+		add(rule.GroupBy...)
+		add(rule.DedupeKey...)
+		add(rule.DistinctField, rule.ValueField)
+		if rule.Sequence != nil {
+			add(rule.Sequence.Key)
+		}
+		if rule.Latency != nil {
+			add(rule.Latency.Key)
+		}
+		if rule.NewValue != nil {
+			add(rule.NewValue.Fields...)
+		}
+		if rule.Template != nil {
+			add(rule.Template.Field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Prints the evaluation of a rule as part of the evaluation tree
+func printRuleEvaluation(Number int, e RuleEvaluation) {
+	rule := e.Rule
+	ruleType := rule.Type
+	if ruleType == "" {
+		ruleType = ruleTypeCount
+	}
+	mode := "any pattern must match"
+	if rule.UseAnd {
+		mode = "all patterns must match (use_and)"
+	}
+	fmt.Printf("  %v. %v (order %v, type %v, %v)\n", Number, e.Name, rule.Order, ruleType, mode)
+	if e.Skipped {
+		fmt.Println("     skipped, a previous rule matched with stop_on_match")
+		return
+	}
+	for i := range e.Patterns {
+		fmt.Printf("     pattern %v: %v%v\n", e.Patterns[i], matchText(e.Patterns[i]), decisionMarker(e, &e.Patterns[i]))
+	}
+	for i := range e.Excludes {
+		fmt.Printf("     exclude %v: %v%v\n", e.Excludes[i], matchText(e.Excludes[i]), decisionMarker(e, &e.Excludes[i]))
+	}
+	fmt.Printf("     => %v\n", e)
+	if e.Match && rule.StopOnMatch {
+		fmt.Println("     stop_on_match: the remaining rules are skipped")
+	}
+}
+
+// Returns the result of a pattern as text
+func matchText(p PatternResult) string {
+	if p.Match {
+		return "match"
+	}
+	return "no match"
+}
+
+// Marks the pattern or exclude deciding the result of the rule
+func decisionMarker(e RuleEvaluation, p *PatternResult) string {
+	if e.Decision == p {
+		return " (decisive)"
+	}
+	return ""
+}
+
+// Describes which rules the hit is attributed to
+func explainResult(e HitEvaluation) string {
+	matches := e.Matches()
+	if len(matches) == 0 {
+		return "not matched by any rule, counted as not matched"
+	}
+	return "counted for " + strings.Join(matches, ", ")
+}
@@ -0,0 +1,24 @@
+package check
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainQuery(t *testing.T) {
+	query := `{"query":{"range":{"@timestamp":{"gt":"_TIMESTAMP_"}}},"runtime_mappings":{"big":{"type":"long","script":{"source":"emit(params.x)","params":{"x":9007199254740993}}}},"fields":["message"],"sort":[{"@timestamp":{"order":"asc"}}],_PAGINATION_}`
+	q, err := explainQuery(query, "abc")
+	if err != nil {
+		t.Fatalf("explainQuery: %v", err)
+	}
+	for _, c := range []string{`"ids":{"values":["abc"]}`, `"fields":["message"]`, `"x":9007199254740993`} {
+		if !strings.Contains(q, c) {
+			t.Errorf("%v missing in %v", c, q)
+		}
+	}
+	for _, c := range []string{`"sort"`, `_TIMESTAMP_`, `_pagination_`} {
+		if strings.Contains(q, c) {
+			t.Errorf("%v not removed from %v", c, q)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Returns the value for the given key of a YAML mapping node or nil, if the
+// node is no mapping or doesn't contain the key
+func mappingValue(Node *yaml.Node, Key string) *yaml.Node {
+	if Node == nil {
+		return nil
+	}
+	if Node.Kind == yaml.AliasNode {
+		Node = Node.Alias
+	}
+	if Node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(Node.Content); i += 2 {
+		if Node.Content[i].Value == Key {
+			return Node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Replaces every rule extending one of the rule Templates in the YAML
+// document of an action file by the merged rule. The fields of the rule override the fields
+// of the template, templates can extend other templates.
+func resolveRuleTemplates(Document *yaml.Node, Templates *yaml.Node) error {
+	if Document.Kind != yaml.DocumentNode || len(Document.Content) == 0 {
+		return nil
+	}
+	root := Document.Content[0]
+	actions := mappingValue(root, "actions")
+	if actions == nil || actions.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, action := range actions.Content {
+		rules := mappingValue(action, "rules")
+		if rules == nil || rules.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(rules.Content); i += 2 {
+			rule, err := extendRule(rules.Content[i+1], Templates, []string{})
+			if err != nil {
+				return fmt.Errorf("rule %v: %v", rules.Content[i].Value, err)
+			}
+			rules.Content[i+1] = rule
+		}
+	}
+	return nil
+}
+
+// Merges a rule with the template it extends. Stack contains the names of the
+// templates already being resolved to detect loops.
+func extendRule(Rule *yaml.Node, Templates *yaml.Node, Stack []string) (*yaml.Node, error) {
+	if Rule.Kind == yaml.AliasNode {
+		Rule = Rule.Alias
+	}
+	extends := mappingValue(Rule, "extends")
+	if extends == nil {
+		return Rule, nil
+	}
+	name := extends.Value
+	for _, s := range Stack {
+		if s == name {
+			return nil, fmt.Errorf("line %v: rule templates extend each other in a loop: %v", extends.Line, strings.Join(append(Stack, name), " -> "))
+		}
+	}
+	template := mappingValue(Templates, name)
+	if template == nil {
+		return nil, fmt.Errorf("line %v: unknown rule template %v", extends.Line, name)
+	}
+	base, err := extendRule(template, Templates, append(Stack, name))
+	if err != nil {
+		return nil, err
+	}
+	merged := &yaml.Node{
+		Kind:   yaml.MappingNode,
+		Tag:    "!!map",
+		Line:   Rule.Line,
+		Column: Rule.Column,
+	}
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		key := base.Content[i].Value
+		if key == "extends" || mappingValue(Rule, key) != nil {
+			continue
+		}
+		merged.Content = append(merged.Content, base.Content[i], base.Content[i+1])
+	}
+	merged.Content = append(merged.Content, Rule.Content...)
+	return merged, nil
+}
+
+// Replaces the references to pattern sets in the patterns of all rules by
+// the patterns of the sets
+func (actions *Actions) resolvePatternSets() error {
+	for i := range actions.Actions {
+		a := &actions.Actions[i]
+		for rulename, rule := range a.Rules {
+			var err error
+			rule.Pattern, err = expandPatternSets(rule.Pattern, actions.PatternSets)
+			if err == nil {
+				rule.Exclude, err = expandPatternSets(rule.Exclude, actions.PatternSets)
+			}
+			if err == nil && rule.Sequence != nil {
+				for s := range rule.Sequence.Steps {
+					step := &rule.Sequence.Steps[s]
+					step.Pattern, err = expandPatternSets(step.Pattern, actions.PatternSets)
+					if err == nil {
+						step.Exclude, err = expandPatternSets(step.Exclude, actions.PatternSets)
+					}
+				}
+			}
+			if err == nil && rule.Latency != nil {
+				rule.Latency.Start, err = expandPatternSets(rule.Latency.Start, actions.PatternSets)
+				if err == nil {
+					rule.Latency.End, err = expandPatternSets(rule.Latency.End, actions.PatternSets)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("action %v, rule %v: %v", a.Name, rulename, err)
+			}
+			a.Rules[rulename] = rule
+		}
+	}
+	return nil
+}
+
+// Returns the patterns with every reference to a pattern set replaced by the
+// patterns of the set
+func expandPatternSets(Patterns []Pattern, Sets map[string][]Pattern) ([]Pattern, error) {
+	var expanded []Pattern
+	for _, p := range Patterns {
+		if p.PatternSet == "" {
+			expanded = append(expanded, p)
+			continue
+		}
+		set, ok := Sets[p.PatternSet]
+		if !ok {
+			return nil, errors.New("unknown pattern set " + p.PatternSet)
+		}
+		for _, s := range set {
+			if s.PatternSet != "" {
+				return nil, errors.New("pattern set " + p.PatternSet + " references another pattern set")
+			}
+		}
+		expanded = append(expanded, set...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,108 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+)
+
+// Latency configures a rule of type "latency". A start event and an end event
+// sharing the same value in the Key field form a pair, the time between them
+// is the latency. The statistic of the rule over all latencies measured during
+// a run is compared against the ranges.
+type Latency struct {
+	Key     string    `json:"key" yaml:"key"`         // Field identifying the start and end event belonging together, e.g. a job id
+	Start   []Pattern `json:"start" yaml:"start"`     // Patterns identifying a start event, one of them must match
+	End     []Pattern `json:"end" yaml:"end"`         // Patterns identifying an end event, one of them must match
+	Timeout string    `json:"timeout" yaml:"timeout"` // Start events without end event are discarded after this duration, defaults to 24h
+	timeout time.Duration
+}
+
+// Checks the latency configuration and sets the defaults
+func (l *Latency) init() error {
+	var err error
+	if l.Key == "" {
+		return errors.New("Latency has no key")
+	}
+	if len(l.Start) == 0 || len(l.End) == 0 {
+		return errors.New("Latency needs start and end patterns")
+	}
+	if l.Timeout == "" {
+		l.Timeout = "24h"
+	}
+	l.timeout, err = time.ParseDuration(l.Timeout)
+	return err
+}
+
+// Applies a hit to a latency rule. A start event is remembered, an end event
+// with a matching start is measured. Returns true, if the hit is a start or
+// end event.
+func (a Action) matchLatency(rulename string, rule Rule, hit elasticsearch.ElasticsearchHitList) (bool, error) {
+	logger := log.With().Str("func", "Action.matchLatency").Str("package", "check").Str("rule", rulename).Str("document_id", hit.Id).Logger()
+	logger.Trace().Msg("Enter func")
+	l := rule.Latency
+	key, ok := hit.Fields.GetValue(l.Key)
+	if !ok {
+		return false, nil
+	}
+	k := fmt.Sprintf("%v", key)
+	ts, err := getTimestamp(hit, "@timestamp")
+	if err != nil {
+		return false, err
+	}
+	pending := a.StatusData.PendingSequences(rulename)
+	end, err := Rule{Pattern: l.End}.isMatch(hit.Fields, hit.Id, rulename)
+	if err != nil {
+		return false, err
+	}
+	if end {
+		p, open := pending[k]
+		if !open {
+			logger.Debug().Str("id", "DBG20180001").Str("key", k).Msg("End event without start event")
+			return true, nil
+		}
+		delete(pending, k)
+		started, err := time.Parse(time.RFC3339Nano, p.Started)
+		if err != nil {
+			return true, nil
+		}
+		ended, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return true, nil
+		}
+		d := ended.Sub(started)
+		line := fmt.Sprintf("%v=%v: %v from %v to %v", l.Key, k, d, p.Started, ts)
+		a.results[rulename] = a.results.AddMeasurement(rulename, rule, d.Seconds(), []string{line})
+		return true, nil
+	}
+	start, err := Rule{Pattern: l.Start}.isMatch(hit.Fields, hit.Id, rulename)
+	if err != nil || !start {
+		return false, err
+	}
+	pending[k] = &PendingSequence{Started: ts}
+	return true, nil
+}
+
+// Discards start events of latency rules which didn't get an end event
+// within the timeout relative to the processed cursor Now. This is called at
+// the end of every run.
+func (a Action) expireLatencies(Now time.Time) {
+	logger := log.With().Str("func", "Action.expireLatencies").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	now := Now.UTC().Format(time.RFC3339Nano)
+	for rulename, rule := range a.Rules {
+		if rule.Type != ruleTypeLatency {
+			continue
+		}
+		pending := a.StatusData.PendingSequences(rulename)
+		for k, p := range pending {
+			if sequenceExpired(p.Started, now, rule.Latency.timeout) {
+				logger.Debug().Str("id", "DBG20180002").Str("rule", rulename).Str("key", k).Str("started", p.Started).Msg("Discarding start event without end event")
+				delete(pending, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package check
+
+import (
+	"testing"
+)
+
+func latencyRule(Timeout string) Rule {
+	return Rule{
+		Type: ruleTypeLatency,
+		Latency: &Latency{
+			Key:     "job",
+			Timeout: Timeout,
+			Start:   []Pattern{{Field: "message", Regex: "^started"}},
+			End:     []Pattern{{Field: "message", Regex: "^finished"}},
+		},
+	}
+}
+
+func TestLatencyEndInFollowingRun(t *testing.T) {
+	a := testAction(t, "latency", latencyRule("10m"))
+	testRun(t, a, testHit("1", "2024-01-01T10:00:00.000Z", map[string]interface{}{"job": "a", "message": "started"}))
+	if _, open := a.StatusData.PendingSequences("latency")["a"]; !open {
+		t.Fatalf("start event discarded at the end of the first run")
+	}
+	r := testRun(t, a, testHit("2", "2024-01-01T10:05:00.000Z", map[string]interface{}{"job": "a", "message": "finished"}))
+	if r.Count("latency") != 1 {
+		t.Errorf("%v latencies measured, expected 1", r.Count("latency"))
+	}
+}
+
+func TestLatencyTimeoutAgainstCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+		open   bool
+	}{
+		{"within", "2024-01-01T10:09:00.000Z", true},
+		{"expired", "2024-01-01T10:11:00.000Z", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAction(t, "latency", latencyRule("10m"))
+			testRun(t, a, testHit("1", "2024-01-01T10:00:00.000Z", map[string]interface{}{"job": "a", "message": "started"}))
+			testRun(t, a, testHit("2", tt.cursor, map[string]interface{}{"job": "b", "message": "other"}))
+			if _, open := a.StatusData.PendingSequences("latency")["a"]; open != tt.open {
+				t.Errorf("start event open at cursor %v: %v, expected %v", tt.cursor, open, tt.open)
+			}
+		})
+	}
+}
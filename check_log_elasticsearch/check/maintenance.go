@@ -0,0 +1,301 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joernott/nagiosplugin/v2"
+)
+
+// Maintenance defines a window during which the state of an action or a rule
+// is capped. Start and End define a one-off window, Schedule and Duration a
+// recurring one. Inside the window, the hits are still counted and reported
+// as performance data, but the state doesn't exceed MaxState and no history
+// entries are created.
+type Maintenance struct {
+	Name     string `json:"name" yaml:"name"`           // Name of the window, used in the output
+	Start    string `json:"start" yaml:"start"`         // Start of a one-off window in RFC3339 format
+	End      string `json:"end" yaml:"end"`             // End of a one-off window in RFC3339 format
+	Schedule string `json:"schedule" yaml:"schedule"`   // Start of a recurring window as cron expression "minute hour day-of-month month day-of-week"
+	Duration string `json:"duration" yaml:"duration"`   // Length of a recurring window, e.g. "2h"
+	Timezone string `json:"timezone" yaml:"timezone"`   // Time zone of the schedule like "Europe/Berlin", defaults to the local time zone
+	MaxState string `json:"max_state" yaml:"max_state"` // Highest state reported during the window: OK (default), WARNING or CRITICAL
+	start    time.Time
+	end      time.Time
+	schedule *cronSchedule
+	duration time.Duration
+	location *time.Location
+	maxState nagiosplugin.Status
+}
+
+// Checks the window and parses its times, schedule and maximum state
+func (m *Maintenance) init() error {
+	var err error
+	switch strings.ToUpper(m.MaxState) {
+	case "", "OK":
+		m.maxState = nagiosplugin.OK
+	case "WARNING":
+		m.maxState = nagiosplugin.WARNING
+	case "CRITICAL":
+		m.maxState = nagiosplugin.CRITICAL
+	default:
+		return errors.New("Unknown max_state " + m.MaxState)
+	}
+	oneOff := m.Start != "" || m.End != ""
+	recurring := m.Schedule != "" || m.Duration != ""
+	if oneOff == recurring {
+		return errors.New("Maintenance window needs either start and end or schedule and duration")
+	}
+	if oneOff {
+		m.start, err = time.Parse(time.RFC3339, m.Start)
+		if err != nil {
+			return fmt.Errorf("Invalid start: %v", err)
+		}
+		m.end, err = time.Parse(time.RFC3339, m.End)
+		if err != nil {
+			return fmt.Errorf("Invalid end: %v", err)
+		}
+		if !m.end.After(m.start) {
+			return errors.New("End of the maintenance window is not after its start")
+		}
+		return nil
+	}
+	m.schedule, err = parseCronSchedule(m.Schedule)
+	if err != nil {
+		return fmt.Errorf("Invalid schedule: %v", err)
+	}
+	m.duration, err = time.ParseDuration(m.Duration)
+	if err != nil {
+		return fmt.Errorf("Invalid duration: %v", err)
+	}
+	if m.duration <= 0 {
+		return errors.New("Duration of the maintenance window must be positive")
+	}
+	m.location = time.Local
+	if m.Timezone != "" {
+		m.location, err = time.LoadLocation(m.Timezone)
+		if err != nil {
+			return fmt.Errorf("Invalid timezone: %v", err)
+		}
+	}
+	return nil
+}
+
+// Returns true together with the end of the window, if the window is active
+// at the given time. A recurring window is active, if the schedule matched
+// a minute within the last Duration.
+func (m Maintenance) activeAt(At time.Time) (time.Time, bool) {
+	if m.schedule == nil {
+		return m.end, !At.Before(m.start) && At.Before(m.end)
+	}
+	t := At.In(m.location)
+	for s := t.Truncate(time.Minute); t.Sub(s) < m.duration; s = s.Add(-time.Minute) {
+		if m.schedule.matches(s) {
+			return s.Add(m.duration), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Returns the name of the window or a description of its times
+func (m Maintenance) String() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	if m.Schedule != "" {
+		return fmt.Sprintf("%q for %v", m.Schedule, m.Duration)
+	}
+	return m.Start + " - " + m.End
+}
+
+// Returns the first field set in the action file to find the window there
+func (m Maintenance) key() string {
+	for _, v := range []string{m.Name, m.Start, m.Schedule, m.End, m.Duration} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// A list of maintenance windows
+type MaintenanceList []Maintenance
+
+// Initializes all windows of the list
+func (l MaintenanceList) init() error {
+	for i := range l {
+		err := l[i].init()
+		if err != nil {
+			return fmt.Errorf("maintenance window %v: %v", l[i], err)
+		}
+	}
+	return nil
+}
+
+// An active maintenance window and the time it ends
+type activeMaintenance struct {
+	window *Maintenance
+	until  time.Time
+}
+
+// Returns the window of the list active at the given time with the lowest
+// maximum state or nil, if no window is active
+func (l MaintenanceList) active(At time.Time) *activeMaintenance {
+	var found *activeMaintenance
+	for i := range l {
+		until, ok := l[i].activeAt(At)
+		if !ok {
+			continue
+		}
+		if found == nil || l[i].maxState < found.window.maxState {
+			found = &activeMaintenance{window: &l[i], until: until}
+		}
+	}
+	return found
+}
+
+// Caps the state at the maximum state of the window
+func (m *activeMaintenance) cap(Status nagiosplugin.Status) nagiosplugin.Status {
+	if m == nil || Status <= m.window.maxState {
+		return Status
+	}
+	return m.window.maxState
+}
+
+// Describes the active window for the long plugin output
+func (m activeMaintenance) String() string {
+	return fmt.Sprintf("maintenance window %v is active until %v, states are capped at %v", m.window, formatTimestamp(m.until), m.window.maxState)
+}
+
+// Returns the active maintenance window for a rule of the action. The windows
+// of the rule and of the action are considered, the one with the lowest
+// maximum state wins.
+func (a Action) maintenance(rule Rule) *activeMaintenance {
+	at := a.evaluationTime()
+	m := rule.Maintenance.active(at)
+	if am := a.Maintenance.active(at); am != nil && (m == nil || am.window.maxState < m.window.maxState) {
+		m = am
+	}
+	return m
+}
+
+// A parsed cron expression with the five fields minute, hour, day of month,
+// month and day of week
+type cronSchedule struct {
+	minute  []bool
+	hour    []bool
+	dom     []bool
+	month   []bool
+	dow     []bool
+	domStar bool
+	dowStar bool
+}
+
+// Names which can be used in the month and day of week fields
+var (
+	cronMonths = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	cronDays   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// Parses a cron expression. Every field can be "*", a value, a range like
+// "1-5", a list like "1,3,5" and a step like "*/15" or "8-18/2". Months and
+// days of the week can be given by their English three letter names, 7 is
+// Sunday as well as 0.
+func parseCronSchedule(Expression string) (*cronSchedule, error) {
+	fields := strings.Fields(Expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in %q, found %v", Expression, len(fields))
+	}
+	var err error
+	s := new(cronSchedule)
+	if s.minute, _, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hour, _, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.dom, s.domStar, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.month, _, err = parseCronField(fields[3], 1, 12, cronMonths); err != nil {
+		return nil, err
+	}
+	if s.dow, s.dowStar, err = parseCronField(fields[4], 0, 7, cronDays); err != nil {
+		return nil, err
+	}
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	return s, nil
+}
+
+// Parses one field of a cron expression into a list of flags for the values
+// from 0 to Max. The second return value is true, if the field starts with
+// "*".
+func parseCronField(Field string, Min int, Max int, Names map[string]int) ([]bool, bool, error) {
+	values := make([]bool, Max+1)
+	value := func(s string) (int, error) {
+		if v, ok := Names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < Min || v > Max {
+			return 0, fmt.Errorf("invalid value %q, expected %v-%v", s, Min, Max)
+		}
+		return v, nil
+	}
+	for _, part := range strings.Split(Field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, false, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		from, to := Min, Max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			from, err = value(bounds[0])
+			if err != nil {
+				return nil, false, err
+			}
+			to = from
+			if len(bounds) == 2 {
+				to, err = value(bounds[1])
+				if err != nil {
+					return nil, false, err
+				}
+			} else if step > 1 {
+				to = Max
+			}
+			if to < from {
+				return nil, false, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+	return values, strings.HasPrefix(Field, "*"), nil
+}
+
+// Returns true, if the schedule matches the minute of the given time in its
+// time zone. Like in cron, a day matches either the day of month or the day of
+// week, if both are restricted.
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+	dom := s.dom[t.Day()]
+	dow := s.dow[int(t.Weekday())]
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
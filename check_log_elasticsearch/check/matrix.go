@@ -0,0 +1,188 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matches a reference to a variable like ${host}
+var variableRegex = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// Replaces every action with vars or a matrix in the YAML document of an
+// action file by the actions expanded from it. An action with a matrix is
+// expanded into one action per combination of the matrix values.
+func expandMatrix(Document *yaml.Node) error {
+	if Document.Kind != yaml.DocumentNode || len(Document.Content) == 0 {
+		return nil
+	}
+	actions := mappingValue(Document.Content[0], "actions")
+	if actions == nil || actions.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var expanded []*yaml.Node
+	for _, action := range actions.Content {
+		vars := mappingValue(action, "vars")
+		matrix := mappingValue(action, "matrix")
+		if vars == nil && matrix == nil {
+			expanded = append(expanded, action)
+			continue
+		}
+		a, err := expandAction(action, vars, matrix)
+		if err != nil {
+			return err
+		}
+		expanded = append(expanded, a...)
+	}
+	actions.Content = expanded
+	return nil
+}
+
+// Expands one action with vars and/or a matrix
+func expandAction(Action *yaml.Node, Vars *yaml.Node, Matrix *yaml.Node) ([]*yaml.Node, error) {
+	name := mappingValue(Action, "name")
+	if name == nil {
+		return nil, fmt.Errorf("line %v: action without name", Action.Line)
+	}
+	constants := make(map[string]string)
+	if Vars != nil {
+		if Vars.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %v: vars of action %v must be a map", Vars.Line, name.Value)
+		}
+		for i := 0; i+1 < len(Vars.Content); i += 2 {
+			constants[Vars.Content[i].Value] = Vars.Content[i+1].Value
+		}
+	}
+	combinations := []map[string]string{{}}
+	var keys []string
+	if Matrix != nil {
+		if Matrix.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %v: matrix of action %v must be a map of lists", Matrix.Line, name.Value)
+		}
+		for i := 0; i+1 < len(Matrix.Content); i += 2 {
+			key := Matrix.Content[i].Value
+			values := Matrix.Content[i+1]
+			if values.Kind != yaml.SequenceNode || len(values.Content) == 0 {
+				return nil, fmt.Errorf("line %v: matrix entry %v of action %v must be a non-empty list", values.Line, key, name.Value)
+			}
+			keys = append(keys, key)
+			var next []map[string]string
+			for _, c := range combinations {
+				for _, v := range values.Content {
+					n := make(map[string]string)
+					for k, cv := range c {
+						n[k] = cv
+					}
+					n[key] = v.Value
+					next = append(next, n)
+				}
+			}
+			combinations = next
+		}
+	}
+	if len(keys) > 0 && mappingValue(Action, "statusfile") == nil {
+		return nil, fmt.Errorf("line %v: the statusfile of action %v must contain the matrix variables like ${%v}", Action.Line, name.Value, keys[0])
+	}
+	var actions []*yaml.Node
+	statusfiles := make(map[string]bool)
+	for _, c := range combinations {
+		values := make(map[string]string)
+		for k, v := range c {
+			values[k] = v
+		}
+		for k, v := range constants {
+			if _, ok := values[k]; !ok {
+				values[k] = variableRegex.ReplaceAllStringFunc(v, func(m string) string {
+					if cv, ok := c[m[2:len(m)-1]]; ok {
+						return cv
+					}
+					return m
+				})
+			}
+		}
+		a := copyNode(Action)
+		var vars []*yaml.Node
+		content := []*yaml.Node{}
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			switch a.Content[i].Value {
+			case "matrix":
+				continue
+			case "vars":
+				vars = a.Content[i : i+2]
+				continue
+			}
+			content = append(content, a.Content[i], a.Content[i+1])
+		}
+		a.Content = content
+		err := substituteVariables(a, values)
+		if err != nil {
+			return nil, fmt.Errorf("action %v: %v", name.Value, err)
+		}
+		if statusfile := mappingValue(a, "statusfile"); len(keys) > 0 && statusfile != nil {
+			if statusfiles[statusfile.Value] {
+				return nil, fmt.Errorf("line %v: the statusfile of action %v is %v for more than one combination of the matrix, it must contain all matrix variables like ${%v}", statusfile.Line, name.Value, statusfile.Value, strings.Join(keys, "} and ${"))
+			}
+			statusfiles[statusfile.Value] = true
+		}
+		n := mappingValue(a, "name")
+		if len(keys) > 0 && n.Value == name.Value {
+			suffix := make([]string, len(keys))
+			for i, k := range keys {
+				suffix[i] = c[k]
+			}
+			n.Value = n.Value + "_" + strings.Join(suffix, "_")
+		}
+		if vars == nil {
+			vars = []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: "vars"}, {}}
+		}
+		vars[1] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for k, v := range values {
+			vars[1].Content = append(vars[1].Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+		}
+		a.Content = append(a.Content, vars...)
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// Returns a deep copy of a YAML node, aliases are replaced by copies of the
+// nodes they point to
+func copyNode(Node *yaml.Node) *yaml.Node {
+	if Node.Kind == yaml.AliasNode {
+		return copyNode(Node.Alias)
+	}
+	n := *Node
+	n.Content = make([]*yaml.Node, len(Node.Content))
+	for i, c := range Node.Content {
+		n.Content[i] = copyNode(c)
+	}
+	return &n
+}
+
+// Replaces the references to variables in all scalars of the node. A
+// reference to an unknown variable is an error.
+func substituteVariables(Node *yaml.Node, Values map[string]string) error {
+	var err error
+	if Node.Kind == yaml.ScalarNode {
+		Node.Value = variableRegex.ReplaceAllStringFunc(Node.Value, func(m string) string {
+			v, ok := Values[m[2:len(m)-1]]
+			if !ok {
+				err = fmt.Errorf("line %v: unknown variable %v", Node.Line, m)
+				return m
+			}
+			return v
+		})
+		return err
+	}
+	for _, c := range Node.Content {
+		err = substituteVariables(c, Values)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
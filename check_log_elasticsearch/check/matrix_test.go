@@ -0,0 +1,82 @@
+package check
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpandMatrix(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  string
+		names   []string
+		errText string
+	}{
+		{
+			"statusfile with all variables",
+			"name: syslog\nstatusfile: /tmp/${host}_${env}.yaml\nmatrix:\n  host: [web1, web2]\n  env: [prod, test]\n",
+			[]string{"syslog_web1_prod", "syslog_web1_test", "syslog_web2_prod", "syslog_web2_test"},
+			"",
+		},
+		{
+			"statusfile through vars",
+			"name: syslog\nstatusfile: /tmp/${file}.yaml\nvars:\n  file: status_${host}\nmatrix:\n  host: [web1, web2]\n",
+			[]string{"syslog_web1", "syslog_web2"},
+			"",
+		},
+		{
+			"statusfile missing a variable",
+			"name: syslog\nstatusfile: /tmp/${host}.yaml\nmatrix:\n  host: [web1, web2]\n  env: [prod, test]\n",
+			nil,
+			"is /tmp/web1.yaml for more than one combination",
+		},
+		{
+			"constant statusfile",
+			"name: syslog\nstatusfile: /tmp/syslog.yaml\nmatrix:\n  host: [web1, web2]\n",
+			nil,
+			"is /tmp/syslog.yaml for more than one combination",
+		},
+		{
+			"no statusfile",
+			"name: syslog\nmatrix:\n  host: [web1, web2]\n",
+			nil,
+			"must contain the matrix variables like ${host}",
+		},
+		{
+			"single combination",
+			"name: syslog\nstatusfile: /tmp/syslog.yaml\nmatrix:\n  host: [web1]\n",
+			[]string{"syslog_web1"},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var document yaml.Node
+			source := "actions:\n  - " + strings.ReplaceAll(strings.TrimSuffix(tt.action, "\n"), "\n", "\n    ") + "\n"
+			if err := yaml.Unmarshal([]byte(source), &document); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			err := expandMatrix(&document)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("error %v, expected %q", err, tt.errText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandMatrix: %v", err)
+			}
+			actions := mappingValue(document.Content[0], "actions").Content
+			if len(actions) != len(tt.names) {
+				t.Fatalf("expanded into %v actions, expected %v", len(actions), len(tt.names))
+			}
+			for i, a := range actions {
+				if n := mappingValue(a, "name").Value; n != tt.names[i] {
+					t.Errorf("action %v is named %v, expected %v", i, n, tt.names[i])
+				}
+			}
+		})
+	}
+}
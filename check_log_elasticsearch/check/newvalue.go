@@ -0,0 +1,156 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+)
+
+// NewValue configures a rule of type "new_value". The values of the Fields of
+// all hits matching the patterns of the rule are remembered in the status
+// file. Values which have not been seen before are counted as hits.
+type NewValue struct {
+	Fields    []string `json:"fields" yaml:"fields"`         // Fields whose values are tracked. The values of multiple fields are combined
+	MaxValues int      `json:"max_values" yaml:"max_values"` // Maximum number of known values, the values not seen for the longest time are forgotten first. Defaults to 10000
+	Expire    string   `json:"expire" yaml:"expire"`         // Values not seen for this duration are forgotten, defaults to 720h
+	Learning  string   `json:"learning" yaml:"learning"`     // During this period after the first run, values are only recorded but not counted
+	expire    time.Duration
+	learning  time.Duration
+}
+
+// KnownValues are the values seen by a rule of type new_value, which are
+// stored in the status file between the check runs.
+type KnownValues struct {
+	Started string            `json:"started" yaml:"started"` // Time of the first run, used for the learning period
+	Values  map[string]string `json:"values" yaml:"values"`   // Timestamp of the last hit by value
+}
+
+// Checks the new_value configuration and sets the defaults
+func (n *NewValue) init() error {
+	var err error
+	if len(n.Fields) == 0 {
+		return errors.New("New value has no fields")
+	}
+	if n.MaxValues <= 0 {
+		n.MaxValues = 10000
+	}
+	if n.Expire == "" {
+		n.Expire = "720h"
+	}
+	n.expire, err = time.ParseDuration(n.Expire)
+	if err != nil {
+		return err
+	}
+	if n.Learning != "" {
+		n.learning, err = time.ParseDuration(n.Learning)
+	}
+	return err
+}
+
+// Returns the values known for a rule of type new_value. Now is used as the
+// start of the learning period, if the rule has no known values yet.
+func (status *StatusData) KnownValues(Rule string, Now time.Time) *KnownValues {
+	if status.NewValues == nil {
+		status.NewValues = make(map[string]*KnownValues)
+	}
+	k, ok := status.NewValues[Rule]
+	if !ok {
+		k = &KnownValues{
+			Started: Now.UTC().Format(time.RFC3339Nano),
+			Values:  make(map[string]string),
+		}
+		status.NewValues[Rule] = k
+	}
+	return k
+}
+
+// Returns true, if the learning period which started at the given time is
+// still active
+func isLearning(Started string, Now time.Time, Learning time.Duration) bool {
+	started, err := time.Parse(time.RFC3339Nano, Started)
+	if err != nil {
+		return false
+	}
+	return Now.Sub(started) < Learning
+}
+
+// Applies a hit to a new_value rule. A value seen for the first time is
+// counted, unless the rule is still learning. A replay starts without known
+// values and doesn't learn. Returns true, if the hit matched the patterns of
+// the rule.
+func (a Action) matchNewValue(rulename string, rule Rule, hit elasticsearch.ElasticsearchHitList) (bool, error) {
+	logger := log.With().Str("func", "Action.matchNewValue").Str("package", "check").Str("rule", rulename).Str("document_id", hit.Id).Logger()
+	logger.Trace().Msg("Enter func")
+	match, err := rule.isMatchOrAll(hit.Fields, hit.Id, rulename)
+	if err != nil || !match {
+		return false, err
+	}
+	n := rule.NewValue
+	values := make([]string, len(n.Fields))
+	for i, field := range n.Fields {
+		v, ok := hit.Fields.GetValue(field)
+		if !ok {
+			return false, nil
+		}
+		values[i] = fmt.Sprintf("%v", v)
+	}
+	value := strings.Join(values, "/")
+	ts, err := getTimestamp(hit, "@timestamp")
+	if err != nil {
+		return false, err
+	}
+	now := a.evaluationTime()
+	known := a.StatusData.KnownValues(rulename, now)
+	_, seen := known.Values[value]
+	known.Values[value] = ts
+	if seen {
+		return true, nil
+	}
+	if !a.replay && isLearning(known.Started, now, n.learning) {
+		logger.Debug().Str("id", "DBG20200001").Str("value", value).Msg("Learning new value")
+		return true, nil
+	}
+	logger.Debug().Str("id", "DBG20200002").Str("value", value).Msg("New value")
+	line := fmt.Sprintf("New value %v=%v first seen at %v", strings.Join(n.Fields, "/"), value, ts)
+	a.results[rulename] = a.results.Add(rulename, []string{line}, rule.OutputLines)
+	return true, nil
+}
+
+// Forgets the values of new_value rules which have not been seen within the
+// expiry period and the values exceeding the maximum number of known values.
+// This is called at the end of every run.
+func (a Action) expireKnownValues(Now time.Time) {
+	logger := log.With().Str("func", "Action.expireKnownValues").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	now := Now.UTC().Format(time.RFC3339Nano)
+	for rulename, rule := range a.Rules {
+		if rule.Type != ruleTypeNewValue {
+			continue
+		}
+		known := a.StatusData.KnownValues(rulename, Now)
+		for value, seen := range known.Values {
+			if sequenceExpired(seen, now, rule.NewValue.expire) {
+				delete(known.Values, value)
+			}
+		}
+		if len(known.Values) <= rule.NewValue.MaxValues {
+			continue
+		}
+		values := make([]string, 0, len(known.Values))
+		for value := range known.Values {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			return known.Values[values[i]] < known.Values[values[j]]
+		})
+		for _, value := range values[:len(values)-rule.NewValue.MaxValues] {
+			delete(known.Values, value)
+		}
+		logger.Debug().Str("id", "DBG20200003").Str("rule", rulename).Int("values", len(known.Values)).Msg("Forgot least recently seen values")
+	}
+}
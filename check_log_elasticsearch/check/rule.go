@@ -1,7 +1,11 @@
 package check
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	//"github.com/davecgh/go-spew/spew"
 	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
@@ -12,28 +16,69 @@ import (
 // List of rules
 type RuleList map[string]Rule
 
+// Rule types
+const (
+	ruleTypeCount    = "count"     // Count the hits matching the patterns
+	ruleTypeSequence = "sequence"  // Count sequences of correlated events
+	ruleTypeLatency  = "latency"   // Measure the time between pairs of start and end events
+	ruleTypeNewValue = "new_value" // Count values of a field never seen before
+	ruleTypeTemplate = "template"  // Count log message templates never seen before
+)
+
 // Definition of a rule to apply on every hit from the Elastcsearch Search
 // result.
 type Rule struct {
-	Description  string    `json:"description" yaml:"description"`     // Only used for documentation/readability purpose.
-	MetricName   string    `json:"metric_name" yaml:"metric_name"`     // The rule name will be used as metric name unless overwritten here
-	Order        int        `json:"order" yaml:"order"`                // Order for sorting the rules
-	Pattern      []Pattern `json:"pattern" yaml:"pattern"`             // A list of patterns which are checked against the fields in the hit
-	Exclude      []Pattern `json:"exclude" yaml:"exclude"`             // If a hit matches, the Exclude pattern are checked. If one of them matches, the hit will be considered not a match
-	UseAnd       bool      `json:"use_and" yaml:"use_and"`             // If true, all Pattern must match (AND), otherwise one of the Pattern suffices (OR).
-	StopOnMatch  bool      `json:"stop_on_match" yaml:"stop_on_match"` // Stop evaluating other rules if thhis rule matches
-	Warning      string    `json:"warning" yaml:"warning"`             // Valid Nagios/Icinga range for the number of hits since the last time, the check was run
-	Critical     string    `json:"critical" yaml:"critical"`           // Valid Nagios/Icinga range for the number of hits since the last time, the check was run
-	OutputFields []string  `json:"output_fields" yaml:"output_fields"` // Which field content should be output to Nagios/Icinga
-	OutputLines  int       `json:"output_lines" yaml:"output_lines"`   // Limits the number of lines to output
-	warnRange    *nagiosplugin.Range
-	critRange    *nagiosplugin.Range
+	Description          string              `json:"description" yaml:"description"`                       // Only used for documentation/readability purpose.
+	Extends              string              `json:"extends" yaml:"extends"`                               // Name of the rule template this rule is based on
+	Type                 string              `json:"type" yaml:"type"`                                     // Type of the rule, "count" (default), "sequence", "latency", "new_value" or "template"
+	MetricName           string              `json:"metric_name" yaml:"metric_name"`                       // The rule name will be used as metric name unless overwritten here
+	Order                int                 `json:"order" yaml:"order"`                                   // Order for sorting the rules
+	Pattern              []Pattern           `json:"pattern" yaml:"pattern"`                               // A list of patterns which are checked against the fields in the hit
+	Exclude              []Pattern           `json:"exclude" yaml:"exclude"`                               // If a hit matches, the Exclude pattern are checked. If one of them matches, the hit will be considered not a match
+	UseAnd               bool                `json:"use_and" yaml:"use_and"`                               // If true, all Pattern must match (AND), otherwise one of the Pattern suffices (OR).
+	StopOnMatch          bool                `json:"stop_on_match" yaml:"stop_on_match"`                   // Stop evaluating other rules if thhis rule matches
+	Warning              string              `json:"warning" yaml:"warning"`                               // Valid Nagios/Icinga range for the number of hits since the last time, the check was run
+	Critical             string              `json:"critical" yaml:"critical"`                             // Valid Nagios/Icinga range for the number of hits since the last time, the check was run
+	OutputFields         []string            `json:"output_fields" yaml:"output_fields"`                   // Which field content should be output to Nagios/Icinga
+	OutputLines          int                 `json:"output_lines" yaml:"output_lines"`                     // Limits the number of lines to output
+	Sequence             *Sequence           `json:"sequence" yaml:"sequence"`                             // Configuration for rules of type sequence
+	Latency              *Latency            `json:"latency" yaml:"latency"`                               // Configuration for rules of type latency
+	NewValue             *NewValue           `json:"new_value" yaml:"new_value"`                           // Configuration for rules of type new_value
+	Template             *TemplateMining     `json:"template" yaml:"template"`                             // Configuration for rules of type template
+	Rate                 string              `json:"rate" yaml:"rate"`                                     // If set to "second", "minute" or "hour", the hits per time unit are compared against the ranges instead of the absolute number
+	MinTotal             uint64              `json:"min_total" yaml:"min_total"`                           // The rule is not evaluated, if less lines than this were read in total
+	GroupBy              []string            `json:"group_by" yaml:"group_by"`                             // Count the hits separately for every distinct combination of the values of these fields and evaluate the thresholds per group
+	MaxGroups            int                 `json:"max_groups" yaml:"max_groups"`                         // Maximum number of groups reported as performance data, defaults to 10
+	DedupeKey            []string            `json:"dedupe_key" yaml:"dedupe_key"`                         // Hits with the same values in these fields as a hit already counted are only counted as duplicates
+	DedupeWindow         string              `json:"dedupe_window" yaml:"dedupe_window"`                   // How long the keys of counted hits are remembered across runs, e.g. "1h". Without a window, hits are only deduplicated within a run
+	DistinctField        string              `json:"distinct_field" yaml:"distinct_field"`                 // Compare the number of distinct values of this field among the hits against the ranges instead of the number of hits
+	DistinctLimit        int                 `json:"distinct_limit" yaml:"distinct_limit"`                 // Number of distinct values counted exactly before switching to an estimation, defaults to 10000
+	ValueField           string              `json:"value_field" yaml:"value_field"`                       // Compare a statistic over this numeric field of the hits against the ranges instead of the number of hits
+	Statistic            string              `json:"statistic" yaml:"statistic"`                           // The statistic to calculate for the value_field: sum, avg, min, max or a percentile like p95. Defaults to avg
+	Unit                 string              `json:"unit" yaml:"unit"`                                     // Nagios unit of measurement for the statistic, e.g. ms or b
+	BaselineWarmup       string              `json:"baseline_warmup" yaml:"baseline_warmup"`               // Duration to collect baseline data before sigma thresholds are evaluated, defaults to 168h
+	BaselineSamples      uint64              `json:"baseline_samples" yaml:"baseline_samples"`             // Maximum number of samples per baseline bucket before older samples lose weight, defaults to 50
+	BaselineMinDeviation float64             `json:"baseline_min_deviation" yaml:"baseline_min_deviation"` // Lower limit for the standard deviation of the baseline, defaults to 1
+	ThresholdSchedules   []ThresholdSchedule `json:"threshold_schedules" yaml:"threshold_schedules"`       // Ranges replacing warning and critical on certain days and at certain times of the day
+	Maintenance          MaintenanceList     `json:"maintenance" yaml:"maintenance"`                       // Windows during which the state of the rule is capped
+	warnRange            *nagiosplugin.Range
+	critRange            *nagiosplugin.Range
+	warnMode             thresholdMode
+	critMode             thresholdMode
+	modes                []thresholdMode
+	schedule             string
+	rateUnit             time.Duration
+	baselineWarmup       time.Duration
+	dedupeWindow         time.Duration
+	statistic            string
+	quantile             float64
 }
 
 // Pattern definition for Rules
 type Pattern struct {
-	Field string `json:"field" yaml:"field"` // Name of a Field in the hit from the Elasticsearch Search
-	Regex string `json:"regex" yaml:"regex"` // GO regular expression to match
+	Field      string `json:"field" yaml:"field"`             // Name of a Field in the hit from the Elasticsearch Search
+	Regex      string `json:"regex" yaml:"regex"`             // GO regular expression to match
+	PatternSet string `json:"pattern_set" yaml:"pattern_set"` // Name of a pattern set to use instead of Field and Regex
 }
 
 // Checks the provided Hit against the rule.
@@ -41,12 +86,15 @@ func (r Rule) isMatch(Hit elasticsearch.HitElement, DocumentId string, RuleName
 	logger := log.With().Str("func", "isMatch").Str("package", "check").Str("document_id", DocumentId).Str("rule", RuleName).Logger()
 	logger.Trace().Msg("Enter func")
 	found := false
-	except := false
 	first := true
 	for _, p := range r.Pattern {
 		s, ok := Hit.GetString(p.Field)
 		if !ok {
-			break
+			if r.UseAnd {
+				found = false
+				break
+			}
+			continue
 		}
 		logger := logger.With().Str("field", p.Field).Str("value", s).Str("regex", p.Regex).Logger()
 		match, err := regexp.MatchString(p.Regex, s)
@@ -72,18 +120,35 @@ func (r Rule) isMatch(Hit elasticsearch.HitElement, DocumentId string, RuleName
 		} else {
 			found = match
 			logger.Trace().Str("id", "DBG20040004").Bool("first", first).Bool("use_and", r.UseAnd).Msg("Result or")
-			break
+			if found {
+				break
+			}
 		}
 	}
 	if !found {
 		logger.Trace().Str("id", "DBG20040005").Bool("found", found).Msg("Skip exception check")
 		return found, nil
 	}
-	first = true
+	except, err := r.isExcluded(Hit, DocumentId, RuleName)
+	if err != nil {
+		return false, err
+	}
+	if except {
+		return false, nil
+	}
+	return found, nil
+}
+
+// Checks the exclude patterns of the rule. Returns true, if one of them
+// matches the hit.
+func (r Rule) isExcluded(Hit elasticsearch.HitElement, DocumentId string, RuleName string) (bool, error) {
+	logger := log.With().Str("func", "isExcluded").Str("package", "check").Str("document_id", DocumentId).Str("rule", RuleName).Logger()
+	logger.Trace().Msg("Enter func")
+	except := false
 	for _, e := range r.Exclude {
 		s, ok := Hit.GetString(e.Field)
 		if !ok {
-			break
+			continue
 		}
 		b := []byte(s)
 		logger = logger.With().Str("field", e.Field).Str("value", s).Str("regex", e.Regex).Logger()
@@ -99,10 +164,17 @@ func (r Rule) isMatch(Hit elasticsearch.HitElement, DocumentId string, RuleName
 			break
 		}
 	}
-	if except {
-		return false, nil
+	return except, nil
+}
+
+// Works like isMatch, but a rule without patterns matches every hit which is
+// not excluded.
+func (r Rule) isMatchOrAll(Hit elasticsearch.HitElement, DocumentId string, RuleName string) (bool, error) {
+	if len(r.Pattern) > 0 {
+		return r.isMatch(Hit, DocumentId, RuleName)
 	}
-	return found, nil
+	except, err := r.isExcluded(Hit, DocumentId, RuleName)
+	return err == nil && !except, err
 }
 
 // Generates a slice of field contents from an elasticsearch hit for the fields
@@ -119,3 +191,116 @@ func (rule Rule) getOutputLines(hit elasticsearch.ElasticsearchHitList) []string
 	}
 	return lines
 }
+
+// Converts the Rate field of a rule into the duration of the time unit. An
+// empty string returns 0, which means, the absolute number of hits is used.
+func parseRateUnit(Rate string) (time.Duration, error) {
+	switch strings.ToLower(Rate) {
+	case "":
+		return 0, nil
+	case "second", "s":
+		return time.Second, nil
+	case "minute", "m":
+		return time.Minute, nil
+	case "hour", "h":
+		return time.Hour, nil
+	}
+	return 0, errors.New("Unknown rate unit " + Rate)
+}
+
+// Returns true, if one of the thresholds of the rule or of its threshold
+// schedules uses the given mode
+func (rule Rule) usesMode(Mode thresholdMode) bool {
+	for _, m := range rule.modes {
+		if m == Mode {
+			return true
+		}
+	}
+	return rule.warnMode == Mode || rule.critMode == Mode
+}
+
+// Sets the defaults for the baseline parameters and parses the warm-up period
+func (rule *Rule) initBaseline() error {
+	var err error
+	if rule.BaselineWarmup == "" {
+		rule.BaselineWarmup = "168h"
+	}
+	if rule.BaselineSamples == 0 {
+		rule.BaselineSamples = 50
+	}
+	if rule.BaselineMinDeviation == 0 {
+		rule.BaselineMinDeviation = 1
+	}
+	rule.baselineWarmup, err = time.ParseDuration(rule.BaselineWarmup)
+	return err
+}
+
+// Returns the key of the group a hit belongs to. This is the combination of
+// the values of the GroupBy fields separated by "/". Missing fields are
+// represented by "-".
+func (rule Rule) groupKey(Hit elasticsearch.HitElement) string {
+	var values []string
+	for _, field := range rule.GroupBy {
+		v, ok := Hit.GetValue(field)
+		if !ok {
+			values = append(values, "-")
+			continue
+		}
+		values = append(values, fmt.Sprintf("%v", v))
+	}
+	return strings.Join(values, "/")
+}
+
+// Returns the unit of measurement for the performance data of the rule
+func (rule Rule) perfUnit() string {
+	if rule.usesStatistic() {
+		return rule.Unit
+	}
+	return "c"
+}
+
+// Returns true, if the value of the rule is a statistic instead of a number
+// of hits
+func (rule Rule) usesStatistic() bool {
+	return rule.ValueField != "" || rule.Type == ruleTypeLatency
+}
+
+// Checks the type of the rule and its type specific configuration
+func (rule *Rule) initType() error {
+	switch rule.Type {
+	case "", ruleTypeCount:
+		rule.Type = ruleTypeCount
+	case ruleTypeSequence:
+		if rule.Sequence == nil {
+			return errors.New("Rule of type sequence has no sequence configuration")
+		}
+		return rule.Sequence.init()
+	case ruleTypeLatency:
+		if rule.Latency == nil {
+			return errors.New("Rule of type latency has no latency configuration")
+		}
+		if rule.Unit == "" {
+			rule.Unit = "s"
+		}
+		return rule.Latency.init()
+	case ruleTypeNewValue:
+		if rule.NewValue == nil {
+			return errors.New("Rule of type new_value has no new_value configuration")
+		}
+		if rule.OutputLines == 0 {
+			rule.OutputLines = 20
+		}
+		return rule.NewValue.init()
+	case ruleTypeTemplate:
+		if rule.Template == nil {
+			return errors.New("Rule of type template has no template configuration")
+		}
+		if rule.OutputLines == 0 {
+			rule.OutputLines = 20
+		}
+		return rule.Template.init()
+	default:
+		return errors.New("Unknown rule type " + rule.Type)
+	}
+	return nil
+}
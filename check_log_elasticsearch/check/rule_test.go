@@ -0,0 +1,74 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+)
+
+func TestRuleIsMatch(t *testing.T) {
+	hit := elasticsearch.HitElement{
+		"message":   "disk /dev/sda failed",
+		"log.level": "error",
+	}
+	disk := Pattern{Field: "message", Regex: "disk"}
+	errorLevel := Pattern{Field: "log.level", Regex: "^error$"}
+	warning := Pattern{Field: "log.level", Regex: "^warning$"}
+	missing := Pattern{Field: "host.name", Regex: "."}
+	tests := []struct {
+		name    string
+		rule    Rule
+		matches bool
+	}{
+		{"or first matches", Rule{Pattern: []Pattern{disk, warning}}, true},
+		{"or later pattern matches", Rule{Pattern: []Pattern{warning, disk}}, true},
+		{"or none matches", Rule{Pattern: []Pattern{warning}}, false},
+		{"or missing field skipped", Rule{Pattern: []Pattern{missing, disk}}, true},
+		{"and all match", Rule{Pattern: []Pattern{disk, errorLevel}, UseAnd: true}, true},
+		{"and one fails", Rule{Pattern: []Pattern{disk, warning}, UseAnd: true}, false},
+		{"and missing field after match", Rule{Pattern: []Pattern{disk, missing}, UseAnd: true}, false},
+		{"and missing field first", Rule{Pattern: []Pattern{missing, disk}, UseAnd: true}, false},
+		{"excluded", Rule{Pattern: []Pattern{disk}, Exclude: []Pattern{{Field: "message", Regex: "sda"}}}, false},
+		{"not excluded", Rule{Pattern: []Pattern{disk}, Exclude: []Pattern{{Field: "message", Regex: "sdb"}}}, true},
+		{"exclude after missing field", Rule{Pattern: []Pattern{disk}, Exclude: []Pattern{missing, errorLevel}}, false},
+		{"and excluded", Rule{Pattern: []Pattern{disk, errorLevel}, UseAnd: true, Exclude: []Pattern{errorLevel}}, false},
+		{"no patterns", Rule{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.rule.isMatch(hit, "1", "test")
+			if err != nil {
+				t.Fatalf("isMatch: %v", err)
+			}
+			if match != tt.matches {
+				t.Errorf("match is %v, expected %v", match, tt.matches)
+			}
+		})
+	}
+}
+
+func TestRuleIsExcluded(t *testing.T) {
+	hit := elasticsearch.HitElement{"message": "disk /dev/sda failed"}
+	tests := []struct {
+		name     string
+		exclude  []Pattern
+		excluded bool
+	}{
+		{"none", nil, false},
+		{"matches", []Pattern{{Field: "message", Regex: "sda"}}, true},
+		{"no match", []Pattern{{Field: "message", Regex: "sdb"}}, false},
+		{"missing field skipped", []Pattern{{Field: "host.name", Regex: "."}, {Field: "message", Regex: "failed"}}, true},
+		{"only missing field", []Pattern{{Field: "host.name", Regex: "."}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			excluded, err := Rule{Exclude: tt.exclude}.isExcluded(hit, "1", "test")
+			if err != nil {
+				t.Fatalf("isExcluded: %v", err)
+			}
+			if excluded != tt.excluded {
+				t.Errorf("excluded is %v, expected %v", excluded, tt.excluded)
+			}
+		})
+	}
+}
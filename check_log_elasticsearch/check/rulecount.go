@@ -2,7 +2,9 @@ package check
 
 import (
 	"fmt"
+	"sort"
 
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
 	"github.com/joernott/nagiosplugin/v2"
 	"github.com/rs/zerolog/log"
 )
@@ -13,8 +15,12 @@ type RuleCount map[string]RuleCountEntry
 // Every Renty consists of a number of Hits and a slice of Contents from all the
 // hits, which are output to Nagios/Icinga2
 type RuleCountEntry struct {
-	Count uint64   // Number of Hits
-	Lines []string // Excerpt of data
+	Count      uint64                    // Number of Hits
+	Lines      []string                  // Excerpt of data
+	Groups     map[string]RuleCountEntry // Hits per group for rules using group_by
+	Distinct   *Cardinality              // Distinct values of the distinct_field of the hits
+	Stats      *Statistic                // Statistic over the value_field of the hits
+	Duplicates uint64                    // Number of hits not counted because of the dedupe_key
 }
 
 // Extract just the number from the RuleCount map.
@@ -40,6 +46,130 @@ func (r RuleCount) Add(Name string, Lines []string, MaxLines int) RuleCountEntry
 	return rule
 }
 
+// Add a hit matching a rule to the RuleCount entry with the given name. This
+// takes care of the groups, distinct values and statistics, if the rule uses
+// them.
+func (r RuleCount) AddHit(Name string, rule Rule, Hit elasticsearch.ElasticsearchHitList) RuleCountEntry {
+	lines := rule.getOutputLines(Hit)
+	if len(rule.GroupBy) == 0 {
+		entry := r.Add(Name, lines, rule.OutputLines)
+		entry.addDistinct(rule, Hit.Fields)
+		entry.addValue(rule, Hit.Fields)
+		return entry
+	}
+	group := rule.groupKey(Hit.Fields)
+	entry := r.AddGroup(Name, group, lines, rule.OutputLines)
+	g := entry.Groups[group]
+	g.addDistinct(rule, Hit.Fields)
+	g.addValue(rule, Hit.Fields)
+	entry.Groups[group] = g
+	entry.addDistinct(rule, Hit.Fields)
+	entry.addValue(rule, Hit.Fields)
+	return entry
+}
+
+// Add the value of the distinct_field of the rule to the distinct values of
+// the entry. Hits without this field are not counted.
+func (r *RuleCountEntry) addDistinct(rule Rule, Hit elasticsearch.HitElement) {
+	if rule.DistinctField == "" {
+		return
+	}
+	v, ok := Hit.GetValue(rule.DistinctField)
+	if !ok {
+		return
+	}
+	if r.Distinct == nil {
+		r.Distinct = NewCardinality(rule.DistinctLimit)
+	}
+	r.Distinct.Add(fmt.Sprintf("%v", v))
+}
+
+// Add a hit with a measured value like a latency to the RuleCount entry with the
+// given name. The value is added to the statistic of the entry.
+func (r RuleCount) AddMeasurement(Name string, rule Rule, Value float64, Lines []string) RuleCountEntry {
+	entry := r.Add(Name, Lines, rule.OutputLines)
+	if entry.Stats == nil {
+		entry.Stats = NewStatistic(rule.statistic, rule.quantile)
+	}
+	entry.Stats.Add(Value)
+	return entry
+}
+
+// Add the value of the value_field of the rule to the statistic of the entry.
+// Hits without this field or with a value which is not a number are ignored.
+func (r *RuleCountEntry) addValue(rule Rule, Hit elasticsearch.HitElement) {
+	if rule.ValueField == "" {
+		return
+	}
+	v, ok := Hit.GetValue(rule.ValueField)
+	if !ok {
+		return
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		log.Debug().Str("id", "DBG20160001").Str("field", rule.ValueField).Str("value", fmt.Sprintf("%v", v)).Msg("Ignoring value which is not a number")
+		return
+	}
+	if r.Stats == nil {
+		r.Stats = NewStatistic(rule.statistic, rule.quantile)
+	}
+	r.Stats.Add(f)
+}
+
+// Returns the value of the entry which is compared against the ranges of the
+// rule together with a description for the output. This is the statistic
+// over the value_field or the number of distinct values of the distinct_field,
+// if the rule has one of them, otherwise the number of hits.
+func (r RuleCountEntry) Value(rule Rule) (float64, string) {
+	if rule.usesStatistic() {
+		field := rule.ValueField
+		if rule.Type == ruleTypeLatency {
+			field = "latency"
+		}
+		v := r.Stats.Value()
+		return v, fmt.Sprintf("%v of %v %v%v in %v hits", rule.statistic, field, v, rule.Unit, r.Count)
+	}
+	if rule.DistinctField != "" {
+		d := r.Distinct.Count()
+		if r.Distinct.IsEstimate() {
+			return float64(d), fmt.Sprintf("Distinct values of %v ~%v (estimated) in %v hits", rule.DistinctField, d, r.Count)
+		}
+		return float64(d), fmt.Sprintf("Distinct values of %v %v in %v hits", rule.DistinctField, d, r.Count)
+	}
+	return float64(r.Count), fmt.Sprintf("Value %v", r.Count)
+}
+
+// Add a hit to the RuleCount entry with the given name and to the given group
+// within that entry.
+func (r RuleCount) AddGroup(Name string, Group string, Lines []string, MaxLines int) RuleCountEntry {
+	logger := log.With().Str("func", "rulecount.AddGroup").Str("package", "check").Logger()
+	logger.Trace().Str("group", Group).Msg("Enter func")
+	rule := r.Add(Name, nil, MaxLines)
+	if rule.Groups == nil {
+		rule.Groups = make(map[string]RuleCountEntry)
+	}
+	g := RuleCount(rule.Groups)
+	rule.Groups[Group] = g.Add(Group, Lines, MaxLines)
+	return rule
+}
+
+// Returns the names of the groups, sorted descending by the number of hits
+func (r RuleCountEntry) SortedGroups() []string {
+	var groups []string
+	for g := range r.Groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		ci := r.Groups[groups[i]].Count
+		cj := r.Groups[groups[j]].Count
+		if ci != cj {
+			return ci > cj
+		}
+		return groups[i] < groups[j]
+	})
+	return groups
+}
+
 // Outputs the RuleCountEntry to Nagios/Icinga2 as indented lines
 func (r RuleCountEntry) OutputRuleCountLines(nagios *nagiosplugin.Check, MaxLines int) []string {
 	logger := log.With().Str("func", "RuleCountEntry.OutputRuleCountLines").Str("package", "check").Logger()
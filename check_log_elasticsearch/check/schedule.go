@@ -0,0 +1,181 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joernott/nagiosplugin/v2"
+)
+
+// ThresholdSchedule defines warning and critical ranges, which replace the
+// ranges of the rule on certain days and at certain times of the day. If
+// From is later than To, the time range spans midnight and the part after
+// midnight belongs to the previous day.
+type ThresholdSchedule struct {
+	Name      string `json:"name" yaml:"name"`         // Name of the schedule, used in the output
+	Days      string `json:"days" yaml:"days"`         // Days of the week in cron syntax like "mon-fri", defaults to every day
+	From      string `json:"from" yaml:"from"`         // Start of the time range like "08:00", defaults to "00:00"
+	To        string `json:"to" yaml:"to"`             // End of the time range like "18:00", excluded, defaults to "24:00"
+	Timezone  string `json:"timezone" yaml:"timezone"` // Time zone of the days and times like "Europe/Berlin", defaults to the local time zone
+	Warning   string `json:"warning" yaml:"warning"`   // Warning range during the schedule, defaults to the warning range of the rule
+	Critical  string `json:"critical" yaml:"critical"` // Critical range during the schedule, defaults to the critical range of the rule
+	days      []bool
+	from      int
+	to        int
+	location  *time.Location
+	warnRange *nagiosplugin.Range
+	critRange *nagiosplugin.Range
+	warnMode  thresholdMode
+	critMode  thresholdMode
+}
+
+// Checks the schedule and parses its days, times and ranges. Warning and
+// Critical are the ranges of the rule used as defaults.
+func (s *ThresholdSchedule) init(Warning string, Critical string) error {
+	var err error
+	if s.Days == "" {
+		s.Days = "*"
+	}
+	s.days, _, err = parseCronField(s.Days, 0, 7, cronDays)
+	if err != nil {
+		return fmt.Errorf("Invalid days: %v", err)
+	}
+	if s.days[7] {
+		s.days[0] = true
+	}
+	if s.From == "" {
+		s.From = "00:00"
+	}
+	if s.To == "" {
+		s.To = "24:00"
+	}
+	s.from, err = parseTimeOfDay(s.From)
+	if err != nil {
+		return fmt.Errorf("Invalid from: %v", err)
+	}
+	s.to, err = parseTimeOfDay(s.To)
+	if err != nil {
+		return fmt.Errorf("Invalid to: %v", err)
+	}
+	if s.from == s.to {
+		return errors.New("The time range of the schedule is empty")
+	}
+	s.location = time.Local
+	if s.Timezone != "" {
+		s.location, err = time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("Invalid timezone: %v", err)
+		}
+	}
+	if s.Warning == "" {
+		s.Warning = Warning
+	}
+	if s.Critical == "" {
+		s.Critical = Critical
+	}
+	s.warnRange, s.warnMode, err = parseThreshold(s.Warning)
+	if err != nil {
+		return fmt.Errorf("Invalid warning range %v: %v", s.Warning, err)
+	}
+	s.critRange, s.critMode, err = parseThreshold(s.Critical)
+	if err != nil {
+		return fmt.Errorf("Invalid critical range %v: %v", s.Critical, err)
+	}
+	return nil
+}
+
+// Parses a time of the day like "08:30" into minutes since midnight. "24:00"
+// is accepted as end of the day.
+func parseTimeOfDay(Value string) (int, error) {
+	parts := strings.Split(Value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("expected HH:MM, found %q", Value)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, found %q", Value)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || h < 0 || m < 0 || m > 59 || h > 24 || h == 24 && m != 0 {
+		return 0, fmt.Errorf("expected HH:MM, found %q", Value)
+	}
+	return h*60 + m, nil
+}
+
+// Returns true, if the schedule is active at the given time
+func (s ThresholdSchedule) activeAt(At time.Time) bool {
+	t := At.In(s.location)
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	if s.from < s.to {
+		return s.days[day] && minute >= s.from && minute < s.to
+	}
+	if minute >= s.from {
+		return s.days[day]
+	}
+	return minute < s.to && s.days[(day+6)%7]
+}
+
+// Returns the name of the schedule or a description of its days and times
+func (s ThresholdSchedule) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("%v %v-%v", s.Days, s.From, s.To)
+}
+
+// Returns the first field set in the action file to find the schedule there
+func (s ThresholdSchedule) key() string {
+	for _, v := range []string{s.Name, s.Days, s.From, s.To, s.Warning, s.Critical} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Parses the threshold schedules of the rule and remembers all threshold
+// modes used by the rule and its schedules
+func (rule *Rule) initSchedules() error {
+	rule.modes = []thresholdMode{rule.warnMode, rule.critMode}
+	for i := range rule.ThresholdSchedules {
+		s := &rule.ThresholdSchedules[i]
+		err := s.init(rule.Warning, rule.Critical)
+		if err != nil {
+			return fmt.Errorf("threshold schedule %v: %v", s, err)
+		}
+		rule.modes = append(rule.modes, s.warnMode, s.critMode)
+	}
+	return nil
+}
+
+// Returns a copy of the rule using the ranges of the first threshold
+// schedule active at the given time. If no schedule is active, the rule is
+// returned unchanged.
+func (rule Rule) scheduled(At time.Time) Rule {
+	for _, s := range rule.ThresholdSchedules {
+		if !s.activeAt(At) {
+			continue
+		}
+		rule.Warning = s.Warning
+		rule.Critical = s.Critical
+		rule.warnRange = s.warnRange
+		rule.critRange = s.critRange
+		rule.warnMode = s.warnMode
+		rule.critMode = s.critMode
+		rule.schedule = s.String()
+		return rule
+	}
+	return rule
+}
+
+// Names the active threshold schedule for the output
+func (rule Rule) scheduleNote() string {
+	if rule.schedule == "" {
+		return ""
+	}
+	return " of threshold schedule " + rule.schedule
+}
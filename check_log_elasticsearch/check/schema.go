@@ -0,0 +1,222 @@
+package check
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The JSON Schema of the action files
+//
+//go:embed actions.schema.json
+var actionSchema []byte
+
+// ActionSchema returns the JSON Schema describing the structure of the
+// action files
+func ActionSchema() []byte {
+	return actionSchema
+}
+
+// The subset of JSON Schema used by the schema of the action files
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 interface{}            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Required             []string               `json:"required"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []string               `json:"enum"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+}
+
+// A problem found in an action file
+type Problem struct {
+	File    string // The action file
+	Line    int    // The line in the action file, 0 if unknown
+	Message string // Description of the problem
+}
+
+// Formats the problem as file:line: message
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%v: %v", p.File, p.Message)
+	}
+	return fmt.Sprintf("%v:%v: %v", p.File, p.Line, p.Message)
+}
+
+// Validates YAML documents against the schema of the action files
+type schemaValidator struct {
+	root     *jsonSchema
+	file     string
+	problems []Problem
+}
+
+// Creates a validator for the action file schema
+func newSchemaValidator() (*schemaValidator, error) {
+	v := new(schemaValidator)
+	err := json.Unmarshal(actionSchema, &v.root)
+	return v, err
+}
+
+// Validates the root node of a YAML document of the given file and returns
+// the problems found
+func (v *schemaValidator) validate(File string, Document *yaml.Node) []Problem {
+	v.file = File
+	v.problems = nil
+	if Document.Kind == yaml.DocumentNode && len(Document.Content) > 0 {
+		v.node(Document.Content[0], v.root, "")
+	}
+	return v.problems
+}
+
+// Adds a problem for the given node
+func (v *schemaValidator) problem(Node *yaml.Node, Path string, Format string, Args ...interface{}) {
+	message := fmt.Sprintf(Format, Args...)
+	if Path != "" {
+		message = Path + ": " + message
+	}
+	v.problems = append(v.problems, Problem{File: v.file, Line: Node.Line, Message: message})
+}
+
+// Returns the definition a schema refers to or the schema itself
+func (v *schemaValidator) resolve(Schema *jsonSchema) *jsonSchema {
+	for Schema != nil && Schema.Ref != "" {
+		Schema = v.root.Definitions[strings.TrimPrefix(Schema.Ref, "#/definitions/")]
+	}
+	return Schema
+}
+
+// Returns the JSON types a YAML node can be decoded as
+func nodeTypes(Node *yaml.Node) []string {
+	switch Node.Kind {
+	case yaml.MappingNode:
+		return []string{"object"}
+	case yaml.SequenceNode:
+		return []string{"array"}
+	case yaml.ScalarNode:
+		switch Node.Tag {
+		case "!!null":
+			return []string{"null"}
+		case "!!int":
+			return []string{"integer", "number", "string"}
+		case "!!float":
+			return []string{"number", "string"}
+		case "!!bool":
+			return []string{"boolean", "string"}
+		}
+		return []string{"string"}
+	}
+	return nil
+}
+
+// Returns the allowed types of a schema
+func (s *jsonSchema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, e := range t {
+			types = append(types, fmt.Sprintf("%v", e))
+		}
+		return types
+	}
+	return nil
+}
+
+// Validates a node and its children against a schema
+func (v *schemaValidator) node(Node *yaml.Node, Schema *jsonSchema, Path string) {
+	Schema = v.resolve(Schema)
+	if Schema == nil {
+		return
+	}
+	if Node.Kind == yaml.AliasNode {
+		Node = Node.Alias
+	}
+	if Node.Kind == yaml.ScalarNode && Node.Tag == "!!null" {
+		return
+	}
+	if allowed := Schema.types(); len(allowed) > 0 {
+		ok := false
+		for _, t := range nodeTypes(Node) {
+			for _, a := range allowed {
+				if t == a {
+					ok = true
+				}
+			}
+		}
+		if !ok {
+			v.problem(Node, Path, "expected %v, found %v", strings.Join(allowed, " or "), nodeTypes(Node)[0])
+			return
+		}
+	}
+	if len(Schema.Enum) > 0 {
+		ok := false
+		for _, e := range Schema.Enum {
+			if Node.Value == e {
+				ok = true
+			}
+		}
+		if !ok {
+			v.problem(Node, Path, "%q must be one of %v", Node.Value, strings.Join(Schema.Enum, ", "))
+		}
+		return
+	}
+	switch Node.Kind {
+	case yaml.MappingNode:
+		v.mapping(Node, Schema, Path)
+	case yaml.SequenceNode:
+		if Schema.Items != nil {
+			for i, item := range Node.Content {
+				v.node(item, Schema.Items, fmt.Sprintf("%v[%v]", Path, i))
+			}
+		}
+	}
+}
+
+// Validates the keys and values of a mapping node against an object schema
+func (v *schemaValidator) mapping(Node *yaml.Node, Schema *jsonSchema, Path string) {
+	prefix := Path
+	if prefix != "" {
+		prefix = prefix + "."
+	}
+	var additional *jsonSchema
+	allowAdditional := true
+	if len(Schema.AdditionalProperties) > 0 {
+		if string(Schema.AdditionalProperties) == "false" {
+			allowAdditional = false
+		} else if string(Schema.AdditionalProperties) != "true" {
+			json.Unmarshal(Schema.AdditionalProperties, &additional)
+		}
+	}
+	keys := make(map[string]bool)
+	for i := 0; i+1 < len(Node.Content); i += 2 {
+		key := Node.Content[i]
+		keys[key.Value] = true
+		if p, ok := Schema.Properties[key.Value]; ok {
+			v.node(Node.Content[i+1], p, prefix+key.Value)
+			continue
+		}
+		if additional != nil {
+			v.node(Node.Content[i+1], additional, prefix+key.Value)
+			continue
+		}
+		if !allowAdditional {
+			known := make([]string, 0, len(Schema.Properties))
+			for k := range Schema.Properties {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			v.problem(key, Path, "unknown field %q, expected one of %v", key.Value, strings.Join(known, ", "))
+		}
+	}
+	for _, r := range Schema.Required {
+		if !keys[r] {
+			v.problem(Node, Path, "missing required field %q", r)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const schemaTestAction = `actions:
+  - name: syslog
+    index: syslog-*
+    query: '{"query":{"range":{"@timestamp":{"gt":"_TIMESTAMP_"}}},_PAGINATION_}'
+    statusfile: /tmp/syslog.yaml
+    rules:
+      errors:
+        pattern:
+          - field: message
+            regex: error
+        warning: "10"
+        critical: "20"
+`
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		replace  string
+		with     string
+		line     int
+		expected string
+	}{
+		{"valid", "", "", 0, ""},
+		{"unknown action field", "    rules:", "    limits: 10\n    rules:", 6, `actions[0]: unknown field "limits", expected one of`},
+		{"mistyped rule field", "        warning:", "        warnign:", 11, `actions[0].rules.errors: unknown field "warnign"`},
+		{"mistyped pattern field", "            regex:", "            regexp:", 10, `unknown field "regexp"`},
+		{"wrong type", "        pattern:", "        use_and: yes please\n        pattern:", 8, `actions[0].rules.errors.use_and: expected boolean, found string`},
+		{"list instead of map", "    rules:\n", "    rules:\n      - errors\n    unused:\n", 7, `actions[0].rules: expected object, found array`},
+		{"unknown enum value", "        pattern:", "        type: counter\n        pattern:", 8, `"counter" must be one of count, sequence`},
+		{"missing required field", "    index: syslog-*\n", "", 2, `actions[0]: missing required field "index"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := schemaTestAction
+			if tt.replace != "" || tt.with != "" {
+				source = strings.Replace(source, tt.replace, tt.with, 1)
+			}
+			var document yaml.Node
+			if err := yaml.Unmarshal([]byte(source), &document); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			v, err := newSchemaValidator()
+			if err != nil {
+				t.Fatalf("newSchemaValidator: %v", err)
+			}
+			problems := v.validate("actions.yaml", &document)
+			if tt.expected == "" {
+				if len(problems) > 0 {
+					t.Errorf("unexpected problems %v", problems)
+				}
+				return
+			}
+			for _, p := range problems {
+				if strings.Contains(p.Message, tt.expected) {
+					if p.Line != tt.line {
+						t.Errorf("problem %q reported in line %v, expected %v", p.Message, p.Line, tt.line)
+					}
+					return
+				}
+			}
+			t.Errorf("problem %q not found in %v", tt.expected, problems)
+		})
+	}
+}
+
+func TestValidateMistypedField(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "actions.yaml")
+	source := strings.Replace(schemaTestAction, "        critical:", "        critcal:", 1)
+	if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	problems := Validate(file)
+	for _, p := range problems {
+		if strings.Contains(p.Message, `unknown field "critcal"`) {
+			return
+		}
+	}
+	t.Errorf("mistyped field not reported, problems: %v", problems)
+}
@@ -0,0 +1,261 @@
+package check
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the selftest
+const (
+	SelfTestTAP   = "tap"   // Test Anything Protocol
+	SelfTestJUnit = "junit" // JUnit XML
+)
+
+// Used as expected rule for documents which must not match any rule
+const expectNone = "none"
+
+// A test case for the rules of an action. Every document is run through the
+// rules and must be counted for exactly the expected rules.
+type RuleTest struct {
+	Name      string                   `json:"name" yaml:"name"`           // Name of the test
+	Documents []map[string]interface{} `json:"documents" yaml:"documents"` // Documents in the format of the hits returned by Elasticsearch
+	Expect    RuleNames                `json:"expect" yaml:"expect"`       // Rule(s) every document must be counted for, "none" if no rule may match
+}
+
+// A list of rule names, which can be given as a single name in the action file
+type RuleNames []string
+
+// Allows a single rule name instead of a list
+func (n *RuleNames) UnmarshalYAML(Value *yaml.Node) error {
+	if Value.Kind == yaml.ScalarNode {
+		*n = RuleNames{Value.Value}
+		return nil
+	}
+	var names []string
+	err := Value.Decode(&names)
+	*n = names
+	return err
+}
+
+// Returns the names of the rules without "none" in sorted order
+func (n RuleNames) rules() []string {
+	var rules []string
+	for _, name := range n {
+		if name != expectNone {
+			rules = append(rules, name)
+		}
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+// Converts the documents of the test into Elasticsearch hits
+func (t RuleTest) hits() ([]elasticsearch.ElasticsearchHitList, error) {
+	var hits []elasticsearch.ElasticsearchHitList
+	for i, d := range t.Documents {
+		b, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		var hit elasticsearch.ElasticsearchHitList
+		err = json.Unmarshal(b, &hit)
+		if err != nil {
+			return nil, err
+		}
+		if hit.Id == "" {
+			hit.Id = fmt.Sprintf("document %v", i+1)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// The result of a test case
+type selfTestResult struct {
+	action   string
+	name     string
+	failures []string
+	err      error
+}
+
+// Returns the name of the test for the output
+func (r selfTestResult) String() string {
+	return r.action + ": " + r.name
+}
+
+// Runs the test case against a copy of the action with an empty status.
+// Returns a description for every document not matching the expected rules.
+func (a Action) runTest(Test RuleTest) ([]string, error) {
+	hits, err := Test.hits()
+	if err != nil {
+		return nil, err
+	}
+	var documents []testDocument
+	for i, hit := range hits {
+		documents = append(documents, testDocument{line: i + 1, hit: hit})
+	}
+	offline := a.offline()
+	evaluations, err := offline.evaluateDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+	var failures []string
+	expected := Test.Expect.rules()
+	for _, e := range evaluations {
+		matches := sortedMatches(e)
+		if strings.Join(matches, ",") == strings.Join(expected, ",") {
+			continue
+		}
+		lines := []string{fmt.Sprintf("%v: expected %v, matched %v", e.Id, ruleList(expected), ruleList(matches))}
+		for _, r := range e.Rules {
+			lines = append(lines, fmt.Sprintf("  %v: %v", r.Name, r))
+		}
+		failures = append(failures, strings.Join(lines, "\n"))
+	}
+	return failures, nil
+}
+
+// Formats a list of rule names for the output
+func ruleList(Rules []string) string {
+	if len(Rules) == 0 {
+		return expectNone
+	}
+	return strings.Join(Rules, ", ")
+}
+
+// Runs the tests of the given actions, all actions if the list is empty, and
+// prints the results in the given format (tap or junit) to stdout. Returns the
+// number of failed tests.
+func (c *Check) SelfTest(Actions []string, Format string) (int, error) {
+	logger := log.With().Str("func", "Check.SelfTest").Str("package", "check").Str("format", Format).Logger()
+	logger.Trace().Msg("Enter func")
+	if Format != SelfTestTAP && Format != SelfTestJUnit {
+		err := errors.New("Unknown output format " + Format)
+		logger.Error().Str("id", "ERR20250001").Err(err).Msg("Invalid format")
+		return 0, err
+	}
+	var results []selfTestResult
+	failed := 0
+	for _, a := range c.actions.Actions {
+		if !actionInList(a.Name, Actions) {
+			continue
+		}
+		for i, t := range a.Tests {
+			r := selfTestResult{action: a.Name, name: t.Name}
+			if r.name == "" {
+				r.name = fmt.Sprintf("test %v", i+1)
+			}
+			r.failures, r.err = a.runTest(t)
+			if r.err != nil || len(r.failures) > 0 {
+				failed++
+			}
+			logger.Debug().Str("id", "DBG20250001").Str("action", a.Name).Str("test", r.name).Int("failures", len(r.failures)).Err(r.err).Msg("Ran test")
+			results = append(results, r)
+		}
+	}
+	if Format == SelfTestJUnit {
+		return failed, writeJUnit(results)
+	}
+	writeTAP(results)
+	return failed, nil
+}
+
+// Prints the results in the Test Anything Protocol format
+func writeTAP(Results []selfTestResult) {
+	fmt.Println("TAP version 13")
+	fmt.Printf("1..%v\n", len(Results))
+	for i, r := range Results {
+		if r.err == nil && len(r.failures) == 0 {
+			fmt.Printf("ok %v - %v\n", i+1, r)
+			continue
+		}
+		fmt.Printf("not ok %v - %v\n", i+1, r)
+		fmt.Println("  ---")
+		if r.err != nil {
+			fmt.Printf("  error: %q\n", r.err.Error())
+		}
+		if len(r.failures) > 0 {
+			fmt.Println("  failures: |")
+			for _, f := range r.failures {
+				for _, l := range strings.Split(f, "\n") {
+					fmt.Println("    " + l)
+				}
+			}
+		}
+		fmt.Println("  ...")
+	}
+}
+
+// The root element of the JUnit XML output
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+// The tests of an action in the JUnit XML output
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+// A single test in the JUnit XML output
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+// A failure or error of a test in the JUnit XML output
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Prints the results as JUnit XML with one test suite per action
+func writeJUnit(Results []selfTestResult) error {
+	var suites junitTestSuites
+	index := make(map[string]int)
+	for _, r := range Results {
+		i, ok := index[r.action]
+		if !ok {
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: r.action})
+			i = len(suites.Suites) - 1
+			index[r.action] = i
+		}
+		s := &suites.Suites[i]
+		tc := junitTestCase{Name: r.name, ClassName: r.action}
+		if r.err != nil {
+			tc.Error = &junitMessage{Message: r.err.Error()}
+			s.Errors++
+		} else if len(r.failures) > 0 {
+			tc.Failure = &junitMessage{
+				Message: fmt.Sprintf("%v of the documents did not match the expected rules", len(r.failures)),
+				Text:    strings.Join(r.failures, "\n"),
+			}
+			s.Failures++
+		}
+		s.Tests++
+		s.Cases = append(s.Cases, tc)
+	}
+	b, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.Stdout.WriteString(xml.Header)
+	os.Stdout.Write(b)
+	fmt.Println()
+	return nil
+}
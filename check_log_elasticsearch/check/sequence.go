@@ -0,0 +1,192 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+)
+
+// Sequence configures a rule of type "sequence". Events with the same value
+// in the Key field are correlated. A sequence is opened by an event matching
+// the first step and completed when all steps have been matched in order.
+// Depending on AlertOn, completed sequences or sequences not completed within
+// the given time are counted as hits for the rule.
+type Sequence struct {
+	Key     string         `json:"key" yaml:"key"`           // Field identifying the events belonging to the same sequence, e.g. a cluster id or user name
+	Steps   []SequenceStep `json:"steps" yaml:"steps"`       // The steps which must be matched in this order
+	Within  string         `json:"within" yaml:"within"`     // Maximum duration between the first and the last step, e.g. 10m
+	AlertOn string         `json:"alert_on" yaml:"alert_on"` // Count sequences which "complete" or which run into a "timeout". Defaults to timeout
+	within  time.Duration
+}
+
+// SequenceStep is one step of a sequence. The patterns work like the ones of
+// a regular rule.
+type SequenceStep struct {
+	Name    string    `json:"name" yaml:"name"`       // Name of the step, used in the output
+	Pattern []Pattern `json:"pattern" yaml:"pattern"` // Patterns an event must match for this step
+	Exclude []Pattern `json:"exclude" yaml:"exclude"` // Patterns excluding an event from this step
+	UseAnd  bool      `json:"use_and" yaml:"use_and"` // If true, all Pattern must match (AND), otherwise one of the Pattern suffices (OR)
+	Count   int       `json:"count" yaml:"count"`     // Number of matching events required to complete the step, defaults to 1
+}
+
+// PendingSequence is the state of an open sequence, which is stored in the
+// status file between the check runs.
+type PendingSequence struct {
+	Step    int      `json:"step" yaml:"step"`                       // Index of the step waiting for events
+	Count   int      `json:"count" yaml:"count"`                     // Number of events already matched for this step
+	Started string   `json:"started" yaml:"started"`                 // Timestamp of the first event of the sequence
+	Lines   []string `json:"lines,omitempty" yaml:"lines,omitempty"` // Output fields of the matched events
+}
+
+// Checks the sequence configuration and sets the defaults
+func (s *Sequence) init() error {
+	var err error
+	if s.Key == "" {
+		return errors.New("Sequence has no key")
+	}
+	if len(s.Steps) == 0 {
+		return errors.New("Sequence has no steps")
+	}
+	for i := range s.Steps {
+		if s.Steps[i].Count < 1 {
+			s.Steps[i].Count = 1
+		}
+		if s.Steps[i].Name == "" {
+			s.Steps[i].Name = fmt.Sprintf("%v", i+1)
+		}
+	}
+	switch s.AlertOn {
+	case "":
+		s.AlertOn = "timeout"
+	case "timeout", "complete":
+	default:
+		return errors.New("Unknown value for alert_on: " + s.AlertOn)
+	}
+	if s.Within == "" {
+		return errors.New("Sequence has no time limit (within)")
+	}
+	s.within, err = time.ParseDuration(s.Within)
+	return err
+}
+
+// Converts a sequence step into a rule to use the pattern matching of rules
+func (step SequenceStep) rule() Rule {
+	return Rule{
+		Pattern: step.Pattern,
+		Exclude: step.Exclude,
+		UseAnd:  step.UseAnd,
+	}
+}
+
+// Returns the open sequences of the given rule stored in the status data
+func (status *StatusData) PendingSequences(Rule string) map[string]*PendingSequence {
+	if status.Sequences == nil {
+		status.Sequences = make(map[string]map[string]*PendingSequence)
+	}
+	p, ok := status.Sequences[Rule]
+	if !ok {
+		p = make(map[string]*PendingSequence)
+		status.Sequences[Rule] = p
+	}
+	return p
+}
+
+// Applies a hit to the sequences of a sequence rule. Returns true, if the hit
+// matched the step its sequence was waiting for.
+func (a Action) matchSequence(rulename string, rule Rule, hit elasticsearch.ElasticsearchHitList) (bool, error) {
+	logger := log.With().Str("func", "Action.matchSequence").Str("package", "check").Str("rule", rulename).Str("document_id", hit.Id).Logger()
+	logger.Trace().Msg("Enter func")
+	seq := rule.Sequence
+	key, ok := hit.Fields.GetValue(seq.Key)
+	if !ok {
+		return false, nil
+	}
+	k := fmt.Sprintf("%v", key)
+	ts, err := getTimestamp(hit, "@timestamp")
+	if err != nil {
+		return false, err
+	}
+	pending := a.StatusData.PendingSequences(rulename)
+	p, open := pending[k]
+	if open && sequenceExpired(p.Started, ts, seq.within) {
+		a.closeSequence(rulename, rule, k, p, "timeout")
+		open = false
+	}
+	step := 0
+	if open {
+		step = p.Step
+	}
+	match, err := seq.Steps[step].rule().isMatch(hit.Fields, hit.Id, rulename)
+	if err != nil || !match {
+		return false, err
+	}
+	if !open {
+		p = &PendingSequence{Started: ts}
+		pending[k] = p
+	}
+	p.Lines = append(p.Lines, rule.getOutputLines(hit)...)
+	p.Count++
+	logger.Trace().Str("id", "DBG20170001").Str("key", k).Int("step", p.Step).Int("count", p.Count).Msg("Sequence step matched")
+	if p.Count >= seq.Steps[p.Step].Count {
+		p.Step++
+		p.Count = 0
+	}
+	if p.Step >= len(seq.Steps) {
+		a.closeSequence(rulename, rule, k, p, "complete")
+	}
+	return true, nil
+}
+
+// Closes all open sequences of the action, which were not completed in time
+// relative to the processed cursor Now. This is called at the end of every
+// run.
+func (a Action) expireSequences(Now time.Time) {
+	logger := log.With().Str("func", "Action.expireSequences").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	now := Now.UTC().Format(time.RFC3339Nano)
+	for rulename, rule := range a.Rules {
+		if rule.Type != ruleTypeSequence {
+			continue
+		}
+		for k, p := range a.StatusData.PendingSequences(rulename) {
+			if sequenceExpired(p.Started, now, rule.Sequence.within) {
+				a.closeSequence(rulename, rule, k, p, "timeout")
+			}
+		}
+	}
+}
+
+// Removes a sequence from the open sequences and counts it as hit for the
+// rule, if the reason matches the alert_on setting of the rule.
+func (a Action) closeSequence(rulename string, rule Rule, Key string, p *PendingSequence, Reason string) {
+	logger := log.With().Str("func", "Action.closeSequence").Str("package", "check").Logger()
+	logger.Debug().Str("id", "DBG20170002").Str("rule", rulename).Str("key", Key).Str("reason", Reason).Msg("Sequence closed")
+	delete(a.StatusData.PendingSequences(rulename), Key)
+	if Reason != rule.Sequence.AlertOn {
+		return
+	}
+	var line string
+	if Reason == "timeout" {
+		line = fmt.Sprintf("%v=%v: sequence started %v timed out waiting for step %v", rule.Sequence.Key, Key, p.Started, rule.Sequence.Steps[p.Step].Name)
+	} else {
+		line = fmt.Sprintf("%v=%v: sequence started %v completed", rule.Sequence.Key, Key, p.Started)
+	}
+	lines := append([]string{line}, p.Lines...)
+	a.results[rulename] = a.results.Add(rulename, lines, rule.OutputLines)
+}
+
+// Returns true, if more than Within has passed between the two timestamps
+func sequenceExpired(Started string, Now string, Within time.Duration) bool {
+	s, err := time.Parse(time.RFC3339Nano, Started)
+	if err != nil {
+		return true
+	}
+	n, err := time.Parse(time.RFC3339Nano, Now)
+	if err != nil {
+		return false
+	}
+	return n.Sub(s) > Within
+}
@@ -0,0 +1,94 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+)
+
+// Returns a document with the given timestamp and fields for running it
+// through the rules of an action
+func testHit(Id string, Timestamp string, Fields map[string]interface{}) testDocument {
+	f := elasticsearch.HitElement{"@timestamp": Timestamp}
+	for k, v := range Fields {
+		f[k] = v
+	}
+	return testDocument{hit: elasticsearch.ElasticsearchHitList{Id: Id, Fields: f}}
+}
+
+// Returns an action with the single, initialized rule, which keeps its
+// status data between the runs
+func testAction(t *testing.T, Name string, rule Rule) *Action {
+	t.Helper()
+	if err := rule.initType(); err != nil {
+		t.Fatalf("initType: %v", err)
+	}
+	a := &Action{Name: "test", Rules: RuleList{Name: rule}, StatusData: new(StatusData)}
+	a.orderedRules = OrderedRuleList{}.Append(Name, rule.Order).Sort()
+	return a
+}
+
+// Runs the documents as one check run and returns the results of the run
+func testRun(t *testing.T, a *Action, Documents ...testDocument) RuleCount {
+	t.Helper()
+	a.results = a.newRulecount()
+	a.last_timestamp = ""
+	if _, err := a.evaluateDocuments(Documents); err != nil {
+		t.Fatalf("evaluateDocuments: %v", err)
+	}
+	return a.results
+}
+
+func sequenceRule(AlertOn string) Rule {
+	return Rule{
+		Type: ruleTypeSequence,
+		Sequence: &Sequence{
+			Key:     "job",
+			Within:  "10m",
+			AlertOn: AlertOn,
+			Steps: []SequenceStep{
+				{Name: "start", Pattern: []Pattern{{Field: "message", Regex: "^started"}}},
+				{Name: "end", Pattern: []Pattern{{Field: "message", Regex: "^finished"}}},
+			},
+		},
+	}
+}
+
+func TestSequenceStepInFollowingRun(t *testing.T) {
+	a := testAction(t, "seq", sequenceRule("complete"))
+	r := testRun(t, a, testHit("1", "2024-01-01T10:00:00.000Z", map[string]interface{}{"job": "a", "message": "started"}))
+	if r.Count("seq") != 0 {
+		t.Fatalf("sequence counted after the first step: %v", r.Count("seq"))
+	}
+	if _, open := a.StatusData.PendingSequences("seq")["a"]; !open {
+		t.Fatalf("sequence expired at the end of the first run")
+	}
+	r = testRun(t, a, testHit("2", "2024-01-01T10:05:00.000Z", map[string]interface{}{"job": "a", "message": "finished"}))
+	if r.Count("seq") != 1 {
+		t.Errorf("sequence completed in the following run counted %v times, expected 1", r.Count("seq"))
+	}
+	if len(a.StatusData.PendingSequences("seq")) != 0 {
+		t.Errorf("completed sequence still open")
+	}
+}
+
+func TestSequenceTimeoutAgainstCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		timeout uint64
+	}{
+		{"within", "2024-01-01T10:09:00.000Z", 0},
+		{"expired", "2024-01-01T10:11:00.000Z", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAction(t, "seq", sequenceRule("timeout"))
+			testRun(t, a, testHit("1", "2024-01-01T10:00:00.000Z", map[string]interface{}{"job": "a", "message": "started"}))
+			r := testRun(t, a, testHit("2", tt.cursor, map[string]interface{}{"job": "b", "message": "other"}))
+			if r.Count("seq") != tt.timeout {
+				t.Errorf("%v timeouts at cursor %v, expected %v", r.Count("seq"), tt.cursor, tt.timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A Snooze silences a history entry, a rule or a whole action until the given
+// time. If neither Uuid nor Rule is set, the snooze applies to the action.
+// Expired snoozes are removed from the status file.
+type Snooze struct {
+	Uuid  string `json:"uuid,omitempty" yaml:"uuid,omitempty"` // The history entry to silence
+	Rule  string `json:"rule,omitempty" yaml:"rule,omitempty"` // The rule to silence, optionally followed by the group in brackets
+	Until string `json:"until" yaml:"until"`                   // End of the snooze in RFC3339 format
+}
+
+// Returns the end of the snooze. Snoozes with an invalid end are expired.
+func (s Snooze) until() time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s.Until)
+	return t
+}
+
+// Returns true, if the snooze silences the history entry with the given Uuid
+// or the given Rule. Name is the name of the rule including the group.
+func (s Snooze) covers(Uuid string, Rule string, Name string) bool {
+	switch {
+	case s.Uuid != "":
+		return s.Uuid == Uuid
+	case s.Rule != "":
+		return s.Rule == Rule || s.Rule == Name
+	}
+	return true
+}
+
+// Describes what the snooze silences
+func (s Snooze) String() string {
+	switch {
+	case s.Uuid != "":
+		return "history entry " + s.Uuid
+	case s.Rule != "":
+		return "rule " + s.Rule
+	}
+	return "all rules"
+}
+
+// Adds a snooze or changes the end of an existing snooze for the same target
+func (status *StatusData) AddSnooze(Uuid string, Rule string, Until time.Time) {
+	until := Until.UTC().Format(time.RFC3339)
+	for i, s := range status.Snoozes {
+		if s.Uuid == Uuid && s.Rule == Rule {
+			status.Snoozes[i].Until = until
+			return
+		}
+	}
+	status.Snoozes = append(status.Snoozes, Snooze{Uuid: Uuid, Rule: Rule, Until: until})
+}
+
+// Removes the snoozes which expired before the given time
+func (status *StatusData) PruneSnoozes(At time.Time) {
+	var active []Snooze
+	for _, s := range status.Snoozes {
+		if s.until().After(At) {
+			active = append(active, s)
+		}
+	}
+	status.Snoozes = active
+}
+
+// Returns the end of the snooze silencing the history entry Uuid or the
+// rule at the given time. Name is the name of the rule including the group.
+// If several snoozes apply, the latest end is returned.
+func (status *StatusData) snoozedUntil(Uuid string, Rule string, Name string, At time.Time) (time.Time, bool) {
+	var until time.Time
+	if status == nil {
+		return until, false
+	}
+	for _, s := range status.Snoozes {
+		if t := s.until(); t.After(At) && t.After(until) && s.covers(Uuid, Rule, Name) {
+			until = t
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// Prints the snoozes active at the given time to stdout
+func (status *StatusData) PrintSnoozes(At time.Time) {
+	first := true
+	for _, s := range status.Snoozes {
+		if !s.until().After(At) {
+			continue
+		}
+		if first {
+			fmt.Println("Snoozed:")
+			first = false
+		}
+		fmt.Printf("   %v until %v\n", s, s.Until)
+	}
+}
+
+// Snoozes history entries, rules or actions until the given time. The
+// Actions parameter specifies the actions to look at, if it is empty, all
+// actions are looked at. If Uuids are given, the history entries with these
+// uuids are snoozed, if Rules are given, these rules are snoozed in all
+// actions containing them. Otherwise, the actions themselves are snoozed,
+// which requires them to be named explicitly.
+func (c *Check) Snooze(Actions []string, Uuids []string, Rules []string, Until time.Time) error {
+	logger := log.With().Str("func", "Check.Snooze").Str("package", "check").Time("until", Until).Logger()
+	logger.Trace().Msg("Enter func")
+	if len(Uuids) == 0 && len(Rules) == 0 && len(Actions) == 0 {
+		err := errors.New("Name the actions to snooze or give history entries or rules")
+		logger.Error().Str("id", "ERR20290001").Err(err).Msg("Nothing to snooze")
+		return err
+	}
+	now := time.Now()
+	found := 0
+	for _, a := range c.actions.Actions {
+		if !actionInList(a.Name, Actions) {
+			logger.Debug().Str("id", "DBG20290001").Str("name", a.Name).Msg("Search not in requested actions, skipping")
+			continue
+		}
+		s, err := ReadStatus(a.StatusFile)
+		if err != nil {
+			logger.Error().Str("id", "ERR20290002").Str("filename", a.StatusFile).Err(err).Msg("Could not read status file")
+			return err
+		}
+		changed := 0
+		for _, u := range Uuids {
+			for _, h := range s.History {
+				if h.Uuid == u {
+					s.AddSnooze(u, "", Until)
+					changed++
+				}
+			}
+		}
+		for _, r := range Rules {
+			if _, ok := a.Rules[strings.SplitN(r, "[", 2)[0]]; ok {
+				s.AddSnooze("", r, Until)
+				changed++
+			}
+		}
+		if len(Uuids) == 0 && len(Rules) == 0 {
+			s.AddSnooze("", "", Until)
+			changed++
+		}
+		if changed == 0 {
+			continue
+		}
+		s.PruneSnoozes(now)
+		err = s.Save(a.StatusFile)
+		if err != nil {
+			return err
+		}
+		logger.Info().Str("id", "INF20290001").Str("name", a.Name).Int("snoozes", changed).Msg("Snoozed")
+		found += changed
+	}
+	if found == 0 {
+		err := errors.New("None of the history entries or rules were found")
+		logger.Error().Str("id", "ERR20290003").Strs("uuids", Uuids).Strs("rules", Rules).Err(err).Msg("Nothing snoozed")
+		return err
+	}
+	return nil
+}
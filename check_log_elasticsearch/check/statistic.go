@@ -0,0 +1,201 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Statistic calculates a statistical value over a numeric field of the hits
+// matching a rule. All values are computed in a streaming fashion, so the
+// memory usage does not depend on the number of hits.
+type Statistic struct {
+	Kind     string  // One of sum, avg, min, max or a percentile like p95
+	Samples  uint64  // Number of values added
+	Sum      float64 // Sum of all values
+	Min      float64 // Smallest value
+	Max      float64 // Largest value
+	quantile *p2Quantile
+}
+
+// Checks the statistic configured for a rule and returns its normalized name
+// and, for percentiles, the quantile between 0 and 1.
+func parseStatistic(Statistic string) (string, float64, error) {
+	s := strings.ToLower(strings.TrimSpace(Statistic))
+	switch s {
+	case "", "avg", "mean":
+		return "avg", 0, nil
+	case "sum", "min", "max":
+		return s, 0, nil
+	}
+	if strings.HasPrefix(s, "p") {
+		p, err := strconv.ParseFloat(s[1:], 64)
+		if err == nil && p > 0 && p < 100 {
+			return s, p / 100, nil
+		}
+	}
+	return "", 0, errors.New("Unknown statistic " + Statistic)
+}
+
+// Create a new Statistic of the given kind. Quantile is only used for
+// percentiles.
+func NewStatistic(Kind string, Quantile float64) *Statistic {
+	s := new(Statistic)
+	s.Kind = Kind
+	if Quantile > 0 {
+		s.quantile = newP2Quantile(Quantile)
+	}
+	return s
+}
+
+// Add a value to the statistic
+func (s *Statistic) Add(Value float64) {
+	if s.Samples == 0 || Value < s.Min {
+		s.Min = Value
+	}
+	if s.Samples == 0 || Value > s.Max {
+		s.Max = Value
+	}
+	s.Samples++
+	s.Sum += Value
+	if s.quantile != nil {
+		s.quantile.Add(Value)
+	}
+}
+
+// Returns the value of the statistic, 0 if no values have been added
+func (s *Statistic) Value() float64 {
+	if s == nil || s.Samples == 0 {
+		return 0
+	}
+	switch s.Kind {
+	case "sum":
+		return s.Sum
+	case "min":
+		return s.Min
+	case "max":
+		return s.Max
+	case "avg":
+		return s.Sum / float64(s.Samples)
+	}
+	if s.quantile != nil {
+		return s.quantile.Value()
+	}
+	return 0
+}
+
+// Converts a field value from a hit into a number
+func toFloat(Value interface{}) (float64, bool) {
+	switch v := Value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	f, err := strconv.ParseFloat(fmt.Sprintf("%v", Value), 64)
+	return f, err == nil
+}
+
+// p2Quantile estimates a quantile without storing the values using the P²
+// algorithm by Jain and Chlamtac.
+type p2Quantile struct {
+	p       float64
+	count   int
+	heights [5]float64
+	pos     [5]float64
+	desired [5]float64
+	inc     [5]float64
+}
+
+// Create a new estimator for the quantile P (0 < P < 1)
+func newP2Quantile(P float64) *p2Quantile {
+	return &p2Quantile{
+		p:   P,
+		inc: [5]float64{0, P / 2, P, (1 + P) / 2, 1},
+	}
+}
+
+// Add a value to the estimator
+func (q *p2Quantile) Add(Value float64) {
+	if q.count < 5 {
+		q.heights[q.count] = Value
+		q.count++
+		if q.count == 5 {
+			sort.Float64s(q.heights[:])
+			for i := 0; i < 5; i++ {
+				q.pos[i] = float64(i + 1)
+			}
+			q.desired = [5]float64{1, 1 + 2*q.p, 1 + 4*q.p, 3 + 2*q.p, 5}
+		}
+		return
+	}
+	q.count++
+	k := 0
+	switch {
+	case Value < q.heights[0]:
+		q.heights[0] = Value
+	case Value >= q.heights[4]:
+		q.heights[4] = Value
+		k = 3
+	default:
+		for k = 0; k < 3; k++ {
+			if Value < q.heights[k+1] {
+				break
+			}
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		q.pos[i]++
+	}
+	for i := 0; i < 5; i++ {
+		q.desired[i] += q.inc[i]
+	}
+	for i := 1; i <= 3; i++ {
+		d := q.desired[i] - q.pos[i]
+		if (d >= 1 && q.pos[i+1]-q.pos[i] > 1) || (d <= -1 && q.pos[i-1]-q.pos[i] < -1) {
+			d = math.Copysign(1, d)
+			h := q.parabolic(i, d)
+			if q.heights[i-1] < h && h < q.heights[i+1] {
+				q.heights[i] = h
+			} else {
+				j := i + int(d)
+				q.heights[i] += d * (q.heights[j] - q.heights[i]) / (q.pos[j] - q.pos[i])
+			}
+			q.pos[i] += d
+		}
+	}
+}
+
+// Piecewise parabolic prediction of the height of marker i moved by d
+func (q *p2Quantile) parabolic(i int, d float64) float64 {
+	return q.heights[i] + d/(q.pos[i+1]-q.pos[i-1])*
+		((q.pos[i]-q.pos[i-1]+d)*(q.heights[i+1]-q.heights[i])/(q.pos[i+1]-q.pos[i])+
+			(q.pos[i+1]-q.pos[i]-d)*(q.heights[i]-q.heights[i-1])/(q.pos[i]-q.pos[i-1]))
+}
+
+// Returns the estimated quantile. With less than five values, the exact
+// value is calculated.
+func (q *p2Quantile) Value() float64 {
+	if q.count >= 5 {
+		return q.heights[2]
+	}
+	if q.count == 0 {
+		return 0
+	}
+	v := make([]float64, q.count)
+	copy(v, q.heights[:q.count])
+	sort.Float64s(v)
+	i := int(math.Ceil(q.p*float64(q.count))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return v[i]
+}
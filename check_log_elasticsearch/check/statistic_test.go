@@ -0,0 +1,73 @@
+package check
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestStatistic(t *testing.T) {
+	values := []float64{4, 8, 15, 16, 23, 42}
+	tests := []struct {
+		kind     string
+		expected float64
+	}{
+		{"sum", 108},
+		{"avg", 18},
+		{"min", 4},
+		{"max", 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			s := NewStatistic(tt.kind, 0)
+			for _, v := range values {
+				s.Add(v)
+			}
+			if s.Value() != tt.expected {
+				t.Errorf("%v is %v, expected %v", tt.kind, s.Value(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestQuantileFewValues(t *testing.T) {
+	s := NewStatistic("p50", 0.5)
+	for _, v := range []float64{30, 10, 20} {
+		s.Add(v)
+	}
+	if s.Value() != 20 {
+		t.Errorf("median of 3 values is %v, expected 20", s.Value())
+	}
+}
+
+// The P² estimate is compared against the exact quantile by its rank: the
+// share of the values below the estimate must be within 1% of the quantile
+func TestQuantileEstimate(t *testing.T) {
+	distributions := map[string]func(*rand.Rand) float64{
+		"uniform":     func(r *rand.Rand) float64 { return r.Float64() * 1000 },
+		"normal":      func(r *rand.Rand) float64 { return 200 + 30*r.NormFloat64() },
+		"exponential": func(r *rand.Rand) float64 { return 50 * r.ExpFloat64() },
+	}
+	for name, next := range distributions {
+		for _, p := range []float64{0.5, 0.9, 0.95, 0.99} {
+			t.Run(fmt.Sprintf("%v p%v", name, p*100), func(t *testing.T) {
+				r := rand.New(rand.NewSource(42))
+				s := NewStatistic("p", p)
+				values := make([]float64, 20000)
+				for i := range values {
+					values[i] = next(r)
+					s.Add(values[i])
+				}
+				sort.Float64s(values)
+				estimate := s.Value()
+				rank := float64(sort.SearchFloat64s(values, estimate)) / float64(len(values))
+				if math.Abs(rank-p) > 0.01 {
+					exact := values[int(math.Ceil(p*float64(len(values))))-1]
+					t.Errorf("estimate %.3f has rank %.4f, exact quantile is %.3f", estimate, rank, exact)
+				}
+			})
+		}
+	}
+}
@@ -14,26 +14,57 @@ import (
 
 // The information stored in the status file.
 type StatusData struct {
-	Timestamp string          `json:"timestamp" yaml:"timestamp"` // a Timestamp in the format expected by Elasticsearch in the timestamp field e.g. 1900-01-01T00:00:00.000Z
-	History   []StatusHistory `json:"history" yaml:"history"`     // Slice of historic events.
+	Timestamp string                                 `json:"timestamp" yaml:"timestamp"`                       // a Timestamp in the format expected by Elasticsearch in the timestamp field e.g. 1900-01-01T00:00:00.000Z
+	History   []StatusHistory                        `json:"history" yaml:"history"`                           // Slice of historic events.
+	Baselines map[string]*Baseline                   `json:"baselines,omitempty" yaml:"baselines,omitempty"`   // Baselines for rules with sigma thresholds by rule name
+	Sequences map[string]map[string]*PendingSequence `json:"sequences,omitempty" yaml:"sequences,omitempty"`   // Open sequences and latency start events by rule name and key
+	Dedupe    map[string]map[string]string           `json:"dedupe,omitempty" yaml:"dedupe,omitempty"`         // Keys of counted hits with their timestamp by rule name for rules using dedupe_key
+	NewValues map[string]*KnownValues                `json:"new_values,omitempty" yaml:"new_values,omitempty"` // Known values by rule name for rules of type new_value
+	Templates map[string]*KnownTemplates             `json:"templates,omitempty" yaml:"templates,omitempty"`   // Known log message templates by rule name for rules of type template
+	Snoozes   []Snooze                               `json:"snoozes,omitempty" yaml:"snoozes,omitempty"`       // History entries, rules or the whole action silenced until a given time
 }
 
 // A StatusHistory entry has a Uuid, a Timestamp, when it happened, the
 // resulting State for Nagios/Icinga2 and the name of the Rule.
 // The bool field Handled can be set to true, if the Event has been handled
-// and should not be used for alerting again. The Counter is the numebr of
-// Hits for that rule.
+// and should not be used for alerting again. Every change of the Handled
+// field is kept in Acknowledgements, the last one describes the current
+// state. The Counter is the numebr of Hits for that rule.
 // current will be used to skip over the "historic" events added during the
 // current run.
 type StatusHistory struct {
-	Uuid      string   `json:"uuid" yaml:"uuid"`           // Generated when adding a history entry, used for management
-	Timestamp string   `json:"timestamp" yaml:"timestamp"` //The timestamp of the check
-	State     int      `json:"state" yaml:"state"`         // State reported to Icinga/Nagios
-	Rule      string   `json:"rule" yaml:"rule"`           // Name of the rule which triggered the alarm
-	Handled   bool     `json:"handled" yaml:"handled"`     // If set to true, mark this historic entry as handled
-	Counter   uint64   `json:"counter" yaml:"counter"`     // Number of lines matching the rule
-	Lines     []string `json:"lines" yaml:"lines"`         // An except of the matchinmg lines
-	current   bool
+	Uuid             string            `json:"uuid" yaml:"uuid"`                                             // Generated when adding a history entry, used for management
+	Timestamp        string            `json:"timestamp" yaml:"timestamp"`                                   //The timestamp of the check
+	State            int               `json:"state" yaml:"state"`                                           // State reported to Icinga/Nagios
+	Rule             string            `json:"rule" yaml:"rule"`                                             // Name of the rule which triggered the alarm
+	Group            string            `json:"group,omitempty" yaml:"group,omitempty"`                       // Key of the group which triggered the alarm for rules using group_by
+	Handled          bool              `json:"handled" yaml:"handled"`                                       // If set to true, mark this historic entry as handled
+	Acknowledgements []Acknowledgement `json:"acknowledgements,omitempty" yaml:"acknowledgements,omitempty"` // Every time the entry was handled or un-handled
+	Counter          uint64            `json:"counter" yaml:"counter"`                                       // Number of lines matching the rule
+	Lines            []string          `json:"lines" yaml:"lines"`                                           // An except of the matchinmg lines
+	current          bool
+}
+
+// An Acknowledgement records who handled or un-handled a history entry, when
+// and why.
+type Acknowledgement struct {
+	Handled   bool   `json:"handled" yaml:"handled"`                     // True if the entry was handled, false if it was un-handled
+	Author    string `json:"author" yaml:"author"`                       // Who changed the entry
+	Comment   string `json:"comment,omitempty" yaml:"comment,omitempty"` // Why the entry was changed
+	HandledAt string `json:"handled_at" yaml:"handled_at"`               // When the entry was changed in RFC3339 format
+}
+
+// Describes the acknowledgement for the list and the plugin output
+func (a Acknowledgement) String() string {
+	s := "Un-handled"
+	if a.Handled {
+		s = "Handled"
+	}
+	s = fmt.Sprintf("%v by %v at %v", s, a.Author, a.HandledAt)
+	if a.Comment != "" {
+		s += ": " + a.Comment
+	}
+	return s
 }
 
 // Saves the StatusData structure to the given file
@@ -102,13 +133,14 @@ func ReadStatus(Filename string) (*StatusData, error) {
 }
 
 // Add a history entry to the StatusData Object
-func (status *StatusData) AddHistoryEntry(Timestamp string, State int, Rule string, Counter uint64, Lines []string) {
+func (status *StatusData) AddHistoryEntry(Timestamp string, State int, Rule string, Group string, Counter uint64, Lines []string) {
 	h := StatusHistory{
 		Uuid:      uuid.New().String(),
 		Timestamp: Timestamp,
 		State:     State,
 		Handled:   false,
 		Rule:      Rule,
+		Group:     Group,
 		Counter:   Counter,
 		Lines:     Lines,
 		current:   true,
@@ -116,6 +148,20 @@ func (status *StatusData) AddHistoryEntry(Timestamp string, State int, Rule stri
 	status.History = append(status.History, h)
 }
 
+// Returns the baseline for the given rule, a new one is created if it doesn't
+// exist yet
+func (status *StatusData) Baseline(Rule string) *Baseline {
+	if status.Baselines == nil {
+		status.Baselines = make(map[string]*Baseline)
+	}
+	b, ok := status.Baselines[Rule]
+	if !ok {
+		b = new(Baseline)
+		status.Baselines[Rule] = b
+	}
+	return b
+}
+
 // Sets the Handled field to true for the historic entry with the given Uuid.
 func (status *StatusData) Acknowledge(Uuid string) {
 	for _, h := range status.History {
@@ -181,8 +227,9 @@ func (status *StatusData) RemoveHistoryEntry(Uuids []string, All bool) {
 }
 
 // Sets one or more Entries contained in the list of Uuids from the history
-// of the StatusData to "handled".
-func (status *StatusData) HandleHistoryEntry(Uuids []string, All bool) {
+// of the StatusData to "handled" or, if Ack.Handled is false, back to "not
+// handled". The acknowledgement is added to the entries which changed.
+func (status *StatusData) HandleHistoryEntry(Uuids []string, All bool, Ack Acknowledgement) {
 	var new []StatusHistory
 
 	logger := log.With().Str("func", "status.RemoveHistoryEntry").Str("package", "check").Logger()
@@ -204,9 +251,12 @@ func (status *StatusData) HandleHistoryEntry(Uuids []string, All bool) {
 				}
 			}
 		}
-		if found {
-			logger.Trace().Str("id", "DBG1006005").Str("uuid", h.Uuid).Bool("found", found).Msg("Set history entry to handled")
-			h.Handled = true
+		if found && Ack.Handled == h.Handled {
+			logger.Trace().Str("id", "DBG1006006").Str("uuid", h.Uuid).Bool("handled", h.Handled).Msg("History entry is already in this state, skipping")
+		} else if found {
+			logger.Trace().Str("id", "DBG1006005").Str("uuid", h.Uuid).Bool("handled", Ack.Handled).Msg("Set history entry to handled")
+			h.Handled = Ack.Handled
+			h.Acknowledgements = append(h.Acknowledgements, Ack)
 		}
 		new = append(new, h)
 	}
@@ -240,12 +290,33 @@ func (status *StatusData) PrintHistory(Format string, Caption bool, CaptionForma
 		if HighlightUuid {
 			u="\033[34m" + u + "\033[0m"
 		}
-		fmt.Printf(Format, u, h.Timestamp, states[h.State], h.Counter, handled, h.Rule)
+		fmt.Printf(Format, u, h.Timestamp, states[h.State], h.Counter, handled, h.RuleName())
 		if Command != "" {
 			fmt.Printf("   %s -U %s\n", Command, h.Uuid)
 		}
+		for _, a := range h.Acknowledgements {
+			fmt.Printf("   %s\n", a)
+		}
 		for _, l := range h.Lines {
 			fmt.Printf("   %s\n", l)
 		}
 	}
 }
+
+// Returns the last acknowledgement of the entry, which describes who handled
+// or un-handled it, when and why. The second return value is false, if the
+// entry was never handled.
+func (h StatusHistory) LastAcknowledgement() (Acknowledgement, bool) {
+	if len(h.Acknowledgements) == 0 {
+		return Acknowledgement{}, false
+	}
+	return h.Acknowledgements[len(h.Acknowledgements)-1], true
+}
+
+// Returns the name of the rule including the group, if there is one
+func (h StatusHistory) RuleName() string {
+	if h.Group == "" {
+		return h.Rule
+	}
+	return h.Rule + "[" + h.Group + "]"
+}
@@ -0,0 +1,64 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAcknowledgementHandledAt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "status.yaml")
+	status := &StatusData{Timestamp: "2024-01-01T10:00:00.000Z"}
+	status.AddHistoryEntry("2024-01-01T10:00:00.000Z", 2, "errors", "", 1, nil)
+	status.HandleHistoryEntry(nil, true, Acknowledgement{Handled: true, Author: "alice", HandledAt: "2024-01-01T11:00:00Z"})
+	if err := status.Save(file); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !strings.Contains(string(b), "handled_at: \"2024-01-01T11:00:00Z\"") {
+		t.Errorf("handled_at missing in status file:\n%s", b)
+	}
+	read, err := ReadStatus(file)
+	if err != nil {
+		t.Fatalf("ReadStatus: %v", err)
+	}
+	ack, ok := read.History[0].LastAcknowledgement()
+	if !ok || ack.HandledAt != "2024-01-01T11:00:00Z" {
+		t.Errorf("acknowledgement read back as %+v", ack)
+	}
+}
+
+func TestHandleHistoryEntrySkipsUnchanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		acks    []bool
+		handled bool
+		logged  int
+	}{
+		{"handle", []bool{true}, true, 1},
+		{"handle twice", []bool{true, true}, true, 1},
+		{"unhandle new entry", []bool{false}, false, 0},
+		{"handle and unhandle", []bool{true, false}, false, 2},
+		{"unhandle twice", []bool{true, false, false}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := new(StatusData)
+			status.AddHistoryEntry("2024-01-01T10:00:00.000Z", 2, "errors", "", 1, nil)
+			for _, handled := range tt.acks {
+				status.HandleHistoryEntry(nil, true, Acknowledgement{Handled: handled, Author: "alice"})
+			}
+			h := status.History[0]
+			if h.Handled != tt.handled {
+				t.Errorf("handled is %v, expected %v", h.Handled, tt.handled)
+			}
+			if len(h.Acknowledgements) != tt.logged {
+				t.Errorf("%v acknowledgements logged, expected %v", len(h.Acknowledgements), tt.logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Regular expressions replacing the placeholders of a template in a suggested
+// pattern
+var suggestPlaceholders = map[string]string{
+	templateWildcard: `\S+`,
+	templateNumber:   `[-+]?\d+(?:[.,:]\d+)*[a-zA-Z%]{0,3}`,
+	templateUuid:     `[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}`,
+	templateIp:       `[0-9a-fA-F.:]+(?:/\d{1,2})?`,
+	templateHex:      `(?:0x)?[0-9a-fA-F]+`,
+}
+
+var suggestPlaceholderRegex = regexp.MustCompile(`<\*>|<NUM>|<UUID>|<IP>|<HEX>`)
+
+// A rule suggested for a template of unmatched messages
+type suggestion struct {
+	Description string    `yaml:"description"`
+	Pattern     []Pattern `yaml:"pattern"`
+}
+
+// Suggest runs the query of the action over the time range between From and
+// To and clusters the messages in Field of the hits not matched by any rule
+// into templates. Rules with a pattern for the Top most frequent templates are
+// printed as YAML to be added to the action file.
+func (c *Check) Suggest(Action string, From time.Time, To time.Time, Field string, Similarity float64, Top int) error {
+	logger := log.With().Str("func", "Check.Suggest").Str("package", "check").Str("action", Action).Logger()
+	logger.Trace().Msg("Enter func")
+	ac := -1
+	for i, a := range c.actions.Actions {
+		if a.Name == Action {
+			ac = i
+		}
+	}
+	if ac < 0 {
+		err := errors.New("Action " + Action + " not found")
+		logger.Error().Str("id", "ERR20220001").Err(err).Msg("Unknown action")
+		return err
+	}
+	a := &c.actions.Actions[ac]
+	a.StatusData = new(StatusData)
+	q, err := limitQuery(strings.ReplaceAll(a.Query, "_TIMESTAMP_", formatTimestamp(From)), To)
+	if err != nil {
+		logger.Error().Str("id", "ERR20220002").Str("query", a.Query).Err(err).Msg("Could not add time range to query")
+		return err
+	}
+	var templates TemplateList
+	var total, unmatched uint64
+	err = c.search(ac, q, func(result *elasticsearch.ElasticsearchResult) (string, error) {
+		last := ""
+		for _, hit := range result.Hits.Hits {
+			total++
+			last, _ = getTimestamp(hit, "@timestamp")
+			if a.isMatchedByRule(hit) {
+				continue
+			}
+			unmatched++
+			m, ok := hit.Fields.GetValue(Field)
+			if !ok {
+				continue
+			}
+			templates.Add(fmt.Sprintf("%v", m), Similarity, last)
+		}
+		return last, nil
+	})
+	if err != nil {
+		return err
+	}
+	templates.Sort()
+	logger.Debug().Str("id", "DBG20220001").Uint64("total", total).Uint64("unmatched", unmatched).Int("templates", len(templates)).Msg("Clustered unmatched messages")
+	fmt.Printf("# %v of %v documents between %v and %v are not matched by any rule of action %v, %v templates found\n", unmatched, total, formatTimestamp(From), formatTimestamp(To), Action, len(templates))
+	if len(templates) == 0 {
+		return nil
+	}
+	if Top > 0 && len(templates) > Top {
+		templates = templates[:Top]
+	}
+	rules := &yaml.Node{Kind: yaml.MappingNode}
+	for i, t := range templates {
+		regex := templateRegex(t.Template)
+		if ok, _ := regexp.MatchString(regex, t.Example); !ok {
+			logger.Warn().Str("id", "WRN20220001").Str("template", t.Template).Str("regex", regex).Msg("Suggested pattern doesn't match the example message")
+		}
+		key := &yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Value:       fmt.Sprintf("suggested_%v", i+1),
+			HeadComment: fmt.Sprintf("%v messages (%.1f%%), e.g. %v", t.Count, float64(t.Count)*100/float64(unmatched), t.Example),
+		}
+		value := &yaml.Node{}
+		err = value.Encode(suggestion{
+			Description: t.Template,
+			Pattern:     []Pattern{{Field: Field, Regex: regex}},
+		})
+		if err != nil {
+			return err
+		}
+		rules.Content = append(rules.Content, key, value)
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(map[string]*yaml.Node{"rules": rules})
+}
+
+// Returns true, if one of the rules of the action with a pattern matches the
+// hit. Rules without patterns, e.g. template rules, are not considered.
+func (a Action) isMatchedByRule(hit elasticsearch.ElasticsearchHitList) bool {
+	for _, r := range a.orderedRules {
+		rulename, rule := r.Get(a.Rules)
+		if len(rule.Pattern) == 0 {
+			continue
+		}
+		match, err := rule.isMatch(hit.Fields, hit.Id, rulename)
+		if err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts a template into a regular expression matching all messages of the
+// template. The literal parts are quoted, placeholders are replaced by
+// expressions matching the masked values.
+func templateRegex(Template string) string {
+	tokens := strings.Split(Template, " ")
+	for i, token := range tokens {
+		parts := suggestPlaceholderRegex.FindAllStringIndex(token, -1)
+		r := ""
+		last := 0
+		for _, p := range parts {
+			r += regexp.QuoteMeta(token[last:p[0]]) + suggestPlaceholders[token[p[0]:p[1]]]
+			last = p[1]
+		}
+		tokens[i] = r + regexp.QuoteMeta(token[last:])
+	}
+	return `^\s*` + strings.Join(tokens, `\s+`) + `\s*$`
+}
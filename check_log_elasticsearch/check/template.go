@@ -0,0 +1,269 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+)
+
+// Placeholders replacing the variable parts of a message in a template
+const (
+	templateWildcard = "<*>"
+	templateNumber   = "<NUM>"
+	templateUuid     = "<UUID>"
+	templateIp       = "<IP>"
+	templateHex      = "<HEX>"
+)
+
+// Punctuation which is kept around a masked token, e.g. the brackets in "(10.0.0.1)"
+const templatePunctuation = "()[]{}<>,;:'\"="
+
+var (
+	templateUuidRegex   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	templateIpv4Regex   = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+)?(/\d{1,2})?$`)
+	templateIpv6Regex   = regexp.MustCompile(`^[0-9a-fA-F]{0,4}(:[0-9a-fA-F]{0,4}){2,7}$`)
+	templateNumberRegex = regexp.MustCompile(`^[-+]?\d+([.,:]\d+)*[a-zA-Z%]{0,3}$`)
+	templateHexRegex    = regexp.MustCompile(`^(0x[0-9a-fA-F]+|[0-9a-fA-F]*[0-9][0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*|[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*[0-9][0-9a-fA-F]*)$`)
+)
+
+// TemplateMining configures a rule of type "template". The Field of every hit
+// matching the patterns of the rule is normalized into a template by masking
+// numbers, UUIDs, IP addresses and hex values. Similar templates are merged,
+// the differing tokens are replaced by a wildcard. Templates which have not
+// been seen before are counted as hits.
+type TemplateMining struct {
+	Field        string  `json:"field" yaml:"field"`                 // The field containing the message, defaults to "message"
+	Similarity   float64 `json:"similarity" yaml:"similarity"`       // Minimum share of equal tokens to merge a message into a known template, defaults to 0.6
+	MaxTemplates int     `json:"max_templates" yaml:"max_templates"` // Maximum number of known templates, the templates not seen for the longest time are forgotten first. Defaults to 1000
+	Expire       string  `json:"expire" yaml:"expire"`               // Templates not seen for this duration are forgotten, defaults to 720h
+	Learning     string  `json:"learning" yaml:"learning"`           // During this period after the first run, templates are only recorded but not counted
+	expire       time.Duration
+	learning     time.Duration
+}
+
+// LogTemplate is a template of log messages with the number of messages
+// it has been seen in.
+type LogTemplate struct {
+	Template  string `json:"template" yaml:"template"`     // The tokens of the template separated by a space
+	Count     uint64 `json:"count" yaml:"count"`           // Number of messages matching the template
+	FirstSeen string `json:"first_seen" yaml:"first_seen"` // Timestamp of the first message
+	LastSeen  string `json:"last_seen" yaml:"last_seen"`   // Timestamp of the last message
+	Example   string `json:"example" yaml:"example"`       // The first message
+}
+
+// A list of templates. It is extended by adding messages.
+type TemplateList []*LogTemplate
+
+// KnownTemplates are the templates seen by a rule of type template, which are
+// stored in the status file between the check runs.
+type KnownTemplates struct {
+	Started   string       `json:"started" yaml:"started"`     // Time of the first run, used for the learning period
+	Templates TemplateList `json:"templates" yaml:"templates"` // The known templates
+}
+
+// Checks the template configuration and sets the defaults
+func (t *TemplateMining) init() error {
+	var err error
+	if t.Field == "" {
+		t.Field = "message"
+	}
+	if t.Similarity == 0 {
+		t.Similarity = 0.6
+	}
+	if t.Similarity < 0 || t.Similarity > 1 {
+		return errors.New("Similarity must be between 0 and 1")
+	}
+	if t.MaxTemplates <= 0 {
+		t.MaxTemplates = 1000
+	}
+	if t.Expire == "" {
+		t.Expire = "720h"
+	}
+	t.expire, err = time.ParseDuration(t.Expire)
+	if err != nil {
+		return err
+	}
+	if t.Learning != "" {
+		t.learning, err = time.ParseDuration(t.Learning)
+	}
+	return err
+}
+
+// Splits a message into tokens and masks the variable ones
+func templateTokens(Message string) []string {
+	tokens := strings.Fields(Message)
+	for i, token := range tokens {
+		trimmed := strings.Trim(token, templatePunctuation)
+		if trimmed == "" {
+			continue
+		}
+		mask := ""
+		switch {
+		case templateUuidRegex.MatchString(trimmed):
+			mask = templateUuid
+		case templateIpv4Regex.MatchString(trimmed):
+			mask = templateIp
+		case strings.Count(trimmed, ":") >= 2 && templateIpv6Regex.MatchString(trimmed) && !templateNumberRegex.MatchString(trimmed):
+			mask = templateIp
+		case templateNumberRegex.MatchString(trimmed):
+			mask = templateNumber
+		case len(trimmed) >= 4 && templateHexRegex.MatchString(trimmed):
+			mask = templateHex
+		default:
+			continue
+		}
+		start := strings.Index(token, trimmed)
+		tokens[i] = token[:start] + mask + token[start+len(trimmed):]
+	}
+	return tokens
+}
+
+// Returns the share of tokens which are equal in both token lists. Wildcards
+// in the template are not counted as equal.
+func templateSimilarity(Template []string, Tokens []string) float64 {
+	if len(Template) != len(Tokens) {
+		return 0
+	}
+	if len(Tokens) == 0 {
+		return 1
+	}
+	equal := 0
+	for i := range Tokens {
+		if Template[i] == Tokens[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(Tokens))
+}
+
+// Adds the message to the most similar template with the same number of
+// tokens. If there is no template with at least the given similarity, a new
+// one is created. Returns the template and true, if it is a new one.
+func (t *TemplateList) Add(Message string, Similarity float64, Timestamp string) (*LogTemplate, bool) {
+	tokens := templateTokens(Message)
+	var best *LogTemplate
+	var bestTokens []string
+	bestSimilarity := -1.0
+	for _, template := range *t {
+		tt := strings.Split(template.Template, " ")
+		s := templateSimilarity(tt, tokens)
+		if s >= Similarity && s > bestSimilarity && len(tt) == len(tokens) {
+			best = template
+			bestTokens = tt
+			bestSimilarity = s
+		}
+	}
+	if best == nil {
+		best = &LogTemplate{
+			Template:  strings.Join(tokens, " "),
+			Count:     1,
+			FirstSeen: Timestamp,
+			LastSeen:  Timestamp,
+			Example:   Message,
+		}
+		*t = append(*t, best)
+		return best, true
+	}
+	for i := range bestTokens {
+		if bestTokens[i] != tokens[i] {
+			bestTokens[i] = templateWildcard
+		}
+	}
+	best.Template = strings.Join(bestTokens, " ")
+	best.Count++
+	best.LastSeen = Timestamp
+	return best, false
+}
+
+// Sorts the templates by the number of messages, the most frequent first
+func (t TemplateList) Sort() {
+	sort.SliceStable(t, func(i, j int) bool {
+		return t[i].Count > t[j].Count
+	})
+}
+
+// Returns the templates known for a rule of type template. Now is used as the
+// start of the learning period, if the rule has no known templates yet.
+func (status *StatusData) KnownTemplates(Rule string, Now time.Time) *KnownTemplates {
+	if status.Templates == nil {
+		status.Templates = make(map[string]*KnownTemplates)
+	}
+	k, ok := status.Templates[Rule]
+	if !ok {
+		k = &KnownTemplates{Started: Now.UTC().Format(time.RFC3339Nano)}
+		status.Templates[Rule] = k
+	}
+	return k
+}
+
+// Applies a hit to a template rule. A message resulting in a new template is
+// counted, unless the rule is still learning. A replay starts without known
+// templates and doesn't learn. Returns true, if the hit matched the patterns
+// of the rule.
+func (a Action) matchTemplate(rulename string, rule Rule, hit elasticsearch.ElasticsearchHitList) (bool, error) {
+	logger := log.With().Str("func", "Action.matchTemplate").Str("package", "check").Str("rule", rulename).Str("document_id", hit.Id).Logger()
+	logger.Trace().Msg("Enter func")
+	match, err := rule.isMatchOrAll(hit.Fields, hit.Id, rulename)
+	if err != nil || !match {
+		return false, err
+	}
+	m, ok := hit.Fields.GetValue(rule.Template.Field)
+	if !ok {
+		return false, nil
+	}
+	message := fmt.Sprintf("%v", m)
+	ts, err := getTimestamp(hit, "@timestamp")
+	if err != nil {
+		return false, err
+	}
+	now := a.evaluationTime()
+	known := a.StatusData.KnownTemplates(rulename, now)
+	template, isNew := known.Templates.Add(message, rule.Template.Similarity, ts)
+	if !isNew {
+		return true, nil
+	}
+	if !a.replay && isLearning(known.Started, now, rule.Template.learning) {
+		logger.Debug().Str("id", "DBG20210001").Str("template", template.Template).Msg("Learning new template")
+		return true, nil
+	}
+	logger.Debug().Str("id", "DBG20210002").Str("template", template.Template).Msg("New template")
+	line := fmt.Sprintf("New template \"%v\" first seen at %v: %v", template.Template, ts, message)
+	a.results[rulename] = a.results.Add(rulename, []string{line}, rule.OutputLines)
+	return true, nil
+}
+
+// Forgets the templates of template rules which have not been seen within the
+// expiry period and the templates exceeding the maximum number of known
+// templates. This is called at the end of every run.
+func (a Action) expireTemplates(Now time.Time) {
+	logger := log.With().Str("func", "Action.expireTemplates").Str("package", "check").Logger()
+	logger.Trace().Msg("Enter func")
+	now := Now.UTC().Format(time.RFC3339Nano)
+	for rulename, rule := range a.Rules {
+		if rule.Type != ruleTypeTemplate {
+			continue
+		}
+		known := a.StatusData.KnownTemplates(rulename, Now)
+		templates := TemplateList{}
+		for _, t := range known.Templates {
+			if !sequenceExpired(t.LastSeen, now, rule.Template.expire) {
+				templates = append(templates, t)
+			}
+		}
+		if len(templates) > rule.Template.MaxTemplates {
+			sort.SliceStable(templates, func(i, j int) bool {
+				return templates[i].LastSeen > templates[j].LastSeen
+			})
+			templates = templates[:rule.Template.MaxTemplates]
+			logger.Debug().Str("id", "DBG20210003").Str("rule", rulename).Int("templates", len(templates)).Msg("Forgot least recently seen templates")
+		}
+		templates.Sort()
+		known.Templates = templates
+	}
+}
@@ -0,0 +1,73 @@
+package check
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTemplateTokens(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"Connection from 10.0.0.1:22 closed", "Connection from <IP> closed"},
+		{"took 250ms (retry 3)", "took <NUM> (retry <NUM>)"},
+		{"job 0b8e6d2c-33f4-4d0e-9a61-2f0c3b1d5e7a done", "job <UUID> done"},
+		{"object at 0x7ffd3a2b freed", "object at <HEX> freed"},
+		{"address fe80::1:2 assigned", "address <IP> assigned"},
+		{"user=alice logged in", "user=alice logged in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if s := strings.Join(templateTokens(tt.message), " "); s != tt.expected {
+				t.Errorf("masked as %q, expected %q", s, tt.expected)
+			}
+		})
+	}
+}
+
+// Messages are generated from known templates with random variable parts.
+// Mining them must find every template exactly once with the exact number of
+// messages.
+func TestTemplateMining(t *testing.T) {
+	users := []string{"alice", "bob", "carol", "dave", "eve"}
+	templates := []struct {
+		template string
+		message  func(*rand.Rand) string
+	}{
+		{"User <*> failed login from <IP>", func(r *rand.Rand) string {
+			return fmt.Sprintf("User %v failed login from 10.0.%v.%v", users[r.Intn(len(users))], r.Intn(256), r.Intn(256))
+		}},
+		{"Request <NUM> took <NUM>", func(r *rand.Rand) string {
+			return fmt.Sprintf("Request %v took %vms", r.Intn(100000), r.Intn(5000))
+		}},
+		{"Disk <*> is <NUM> full", func(r *rand.Rand) string {
+			return fmt.Sprintf("Disk /dev/sd%c is %v%% full", 'a'+r.Intn(4), r.Intn(100))
+		}},
+		{"Job <UUID> finished with exit code <NUM>", func(r *rand.Rand) string {
+			return fmt.Sprintf("Job %08x-%04x-%04x-%04x-%012x finished with exit code %v", r.Uint32(), r.Intn(65536), r.Intn(65536), r.Intn(65536), r.Int63n(1<<48), r.Intn(3))
+		}},
+		{"Cache flushed", func(r *rand.Rand) string { return "Cache flushed" }},
+	}
+	r := rand.New(rand.NewSource(42))
+	exact := make(map[string]uint64)
+	var list TemplateList
+	for i := 0; i < 5000; i++ {
+		g := templates[r.Intn(len(templates))]
+		exact[g.template]++
+		list.Add(g.message(r), 0.6, "2024-01-01T10:00:00.000Z")
+	}
+	if len(list) != len(templates) {
+		for _, l := range list {
+			t.Logf("%v: %v", l.Template, l.Count)
+		}
+		t.Fatalf("found %v templates, expected %v", len(list), len(templates))
+	}
+	for _, l := range list {
+		if l.Count != exact[l.Template] {
+			t.Errorf("template %q counted %v messages, expected %v", l.Template, l.Count, exact[l.Template])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/joernott/nagiosplugin/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum size of a single line in an NDJSON file
+const maxDocumentSize = 16 * 1024 * 1024
+
+// A document read from an NDJSON file together with its line number
+type testDocument struct {
+	line int
+	hit  elasticsearch.ElasticsearchHitList
+}
+
+// Reads documents in the format of the hits returned by Elasticsearch from
+// an NDJSON file, one document per line. Empty lines are skipped. Name is
+// used in error messages.
+func readDocuments(Input io.Reader, Name string) ([]testDocument, error) {
+	logger := log.With().Str("func", "readDocuments").Str("package", "check").Str("filename", Name).Logger()
+	logger.Trace().Msg("Enter func")
+	var documents []testDocument
+	scanner := bufio.NewScanner(Input)
+	scanner.Buffer(make([]byte, 64*1024), maxDocumentSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var hit elasticsearch.ElasticsearchHitList
+		err := json.Unmarshal(b, &hit)
+		if err != nil {
+			logger.Error().Str("id", "ERR20240001").Int("line", line).Err(err).Msg("Could not parse document")
+			return nil, fmt.Errorf("%v:%v: %v", Name, line, err)
+		}
+		if hit.Id == "" {
+			hit.Id = fmt.Sprintf("line %v", line)
+		}
+		documents = append(documents, testDocument{line: line, hit: hit})
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Error().Str("id", "ERR20240002").Err(err).Msg("Could not read documents")
+		return nil, fmt.Errorf("%v: %v", Name, err)
+	}
+	logger.Debug().Str("id", "DBG20240001").Int("documents", len(documents)).Msg("Read documents")
+	return documents, nil
+}
+
+// Returns the timestamp of a hit or an empty string, if it has none
+func hitTimestamp(hit elasticsearch.ElasticsearchHitList) string {
+	_, inFields := hit.Fields.Get("@timestamp")
+	_, inSource := hit.Source.Get("@timestamp")
+	if !inFields && !inSource {
+		return ""
+	}
+	ts, _ := getTimestamp(hit, "@timestamp")
+	return ts
+}
+
+// Returns a copy of the action with empty results and an empty status, which
+// is never saved. This is used to run documents through the rules without
+// changing the status file.
+func (a Action) offline() Action {
+	a.StatusData = new(StatusData)
+	a.last_timestamp = ""
+	a.results = a.newRulecount()
+	return a
+}
+
+// Runs the documents through the rules of the action and returns the
+// evaluation of every document. The timestamps of the first and the last
+// document are used as time span for rates.
+func (a *Action) evaluateDocuments(Documents []testDocument) ([]HitEvaluation, error) {
+	var evaluations []HitEvaluation
+	for _, d := range Documents {
+		e := HitEvaluation{Id: d.hit.Id}
+		err := a.countHit(d.hit, &e)
+		if err != nil {
+			return nil, err
+		}
+		evaluations = append(evaluations, e)
+		ts := hitTimestamp(d.hit)
+		if a.last_timestamp == "" {
+			a.last_timestamp = ts
+		}
+		a.setTimestamp(ts)
+	}
+	a.finishRun()
+	return evaluations, nil
+}
+
+// Tests the rules of an action against documents read from Input in NDJSON
+// format without connecting to Elasticsearch. For every document, the rules
+// are printed in their order with the pattern or exclude deciding whether
+// they matched. Finally, the counts and the Nagios output are printed. The
+// status file of the action is neither read nor written. Name is the name of
+// the input used in messages.
+func (c *Check) TestRules(ActionName string, Input io.Reader, Name string) error {
+	logger := log.With().Str("func", "Check.TestRules").Str("package", "check").Str("action", ActionName).Logger()
+	logger.Trace().Msg("Enter func")
+	action, err := c.GetAction(ActionName)
+	if err != nil {
+		return err
+	}
+	documents, err := readDocuments(Input, Name)
+	if err != nil {
+		return err
+	}
+	a := action.offline()
+	evaluations, err := a.evaluateDocuments(documents)
+	if err != nil {
+		return err
+	}
+	for i, e := range evaluations {
+		matches := e.Matches()
+		result := "no rule matched"
+		if len(matches) > 0 {
+			result = "matched " + strings.Join(matches, ", ")
+		}
+		fmt.Printf("%v (line %v): %v\n", e.Id, documents[i].line, result)
+		for _, r := range e.Rules {
+			fmt.Printf("  %v: %v\n", r.Name, r)
+		}
+	}
+	fmt.Println()
+	a.printCounts()
+	fmt.Println()
+	nagios := nagiosplugin.NewCheck()
+	nagios.SetVerbosity(nagiosplugin.VERBOSITY_MULTI_LINE)
+	a.outputResults(nagios, "")
+	fmt.Println(Output(nagios))
+	logger.Debug().Str("id", "DBG20240002").Int("documents", len(documents)).Msg("Tested rules")
+	return nil
+}
+
+// Prints the counts of all rules in their order followed by the total number
+// of documents and the number of documents not matched by any rule
+func (a Action) printCounts() {
+	fmt.Println("Counts:")
+	for _, r := range a.orderedRules {
+		rulename, rule := r.Get(a.Rules)
+		entry := a.results[rulename]
+		_, description := entry.Value(rule)
+		fmt.Printf("  %v: %v hits, %v\n", rulename, entry.Count, description)
+		if entry.Duplicates > 0 {
+			fmt.Printf("  %v: %v duplicates\n", rulename, entry.Duplicates)
+		}
+	}
+	fmt.Printf("  total: %v\n", a.results.Count("_total"))
+	fmt.Printf("  not matched: %v\n", a.results.Count("_nomatch"))
+}
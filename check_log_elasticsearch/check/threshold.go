@@ -0,0 +1,132 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/joernott/nagiosplugin/v2"
+)
+
+// Defines what the value of a rule is compared against
+type thresholdMode int
+
+const (
+	thresholdAbsolute thresholdMode = iota // The number of hits (or the rate, if configured)
+	thresholdPercent                       // The number of hits as percentage of all lines
+	thresholdSigma                         // The deviation from the baseline in multiples of the standard deviation
+)
+
+// Parses a threshold from the action file. A threshold is a Nagios/Icinga range,
+// optionally followed by a unit determining the mode. "5%" compares the
+// percentage of hits of the total number of lines against the range 0:5.
+// "3sigma" compares the deviation from the baseline against the range. As
+// values below the baseline result in negative deviations, a sigma range
+// without a lower limit means ~:3 instead of 0:3.
+func parseThreshold(Threshold string) (*nagiosplugin.Range, thresholdMode, error) {
+	t := strings.TrimSpace(Threshold)
+	mode := thresholdAbsolute
+	if strings.HasSuffix(t, "%") {
+		mode = thresholdPercent
+		t = strings.TrimSuffix(t, "%")
+	} else if strings.HasSuffix(t, "sigma") {
+		mode = thresholdSigma
+		t = strings.TrimSuffix(t, "sigma")
+		if t != "" && !strings.Contains(t, ":") && !strings.HasPrefix(t, "@") {
+			t = "~:" + t
+		}
+	}
+	if t == "" {
+		return nil, mode, errors.New("Empty threshold")
+	}
+	r, err := nagiosplugin.ParseRange(t)
+	return r, mode, err
+}
+
+// Returns the range if the mode matches the wanted mode, otherwise nil. This
+// is used to attach only the relevant ranges to performance data.
+func rangeForMode(Range *nagiosplugin.Range, Mode thresholdMode, Want thresholdMode) *nagiosplugin.Range {
+	if Mode != Want || Range == nil {
+		return nil
+	}
+	return Range
+}
+
+// Matches one performance datum like 'label'=value;warn;crit;min;max
+var perfDatumRegex = regexp.MustCompile(`'[^']*'=[^ ]*`)
+
+// Rewrites a range rendered by the perfdata library into the Nagios threshold
+// format. The library writes infinite limits as -Inf and +Inf, so a missing
+// lower limit becomes ~ and a missing upper limit is left out, e.g. -Inf:3 is
+// written as ~:3 and 100:+Inf as 100:.
+func formatRange(Range string) string {
+	prefix := ""
+	if strings.HasPrefix(Range, "@") {
+		prefix = "@"
+		Range = Range[1:]
+	}
+	start, end := "0", Range
+	if i := strings.Index(Range, ":"); i >= 0 {
+		start, end = Range[:i], Range[i+1:]
+	} else if end != "+Inf" {
+		// The library leaves out a lower limit of 0
+		return prefix + end
+	}
+	if start == "-Inf" {
+		start = "~"
+	}
+	if end == "+Inf" {
+		end = ""
+	}
+	return prefix + start + ":" + end
+}
+
+// Rewrites the warning and critical ranges of the performance data in the
+// first line of the plugin output with formatRange
+func formatPerfData(Output string) string {
+	lines := strings.SplitN(Output, "\n", 2)
+	i := strings.Index(lines[0], " | '")
+	if i < 0 {
+		return Output
+	}
+	perfdata := perfDatumRegex.ReplaceAllStringFunc(lines[0][i:], func(Datum string) string {
+		eq := strings.LastIndex(Datum, "'=")
+		fields := strings.Split(Datum[eq+2:], ";")
+		for f := 1; f < len(fields) && f < 3; f++ {
+			if fields[f] != "" {
+				fields[f] = formatRange(fields[f])
+			}
+		}
+		return Datum[:eq+2] + strings.Join(fields, ";")
+	})
+	lines[0] = lines[0][:i] + perfdata
+	return strings.Join(lines, "\n")
+}
+
+// Output returns the plugin output of the check with the ranges of the
+// performance data in the Nagios threshold format
+func Output(nagios *nagiosplugin.Check) string {
+	return formatPerfData(nagios.String())
+}
+
+// Finish prints the plugin output of the check like nagiosplugin.Check.Finish
+// does, but with the ranges of the performance data in the Nagios threshold
+// format, and exits with the state of the check. Without any result, the
+// library's Finish reports UNKNOWN.
+func Finish(nagios *nagiosplugin.Check) {
+	output := Output(nagios)
+	if output == "OK: " || strings.HasPrefix(output, "OK: \n") {
+		nagios.Finish()
+		return
+	}
+	state := strings.SplitN(output, ":", 2)[0]
+	for _, s := range []nagiosplugin.Status{nagiosplugin.OK, nagiosplugin.WARNING, nagiosplugin.CRITICAL, nagiosplugin.UNKNOWN} {
+		if s.String() == state {
+			fmt.Println(output)
+			os.Exit(int(s))
+		}
+	}
+	nagios.Finish()
+}
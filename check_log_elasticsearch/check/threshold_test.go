@@ -0,0 +1,51 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/joernott/nagiosplugin/v2"
+)
+
+func TestFormatRange(t *testing.T) {
+	tests := []struct {
+		threshold string
+		expected  string
+	}{
+		{"10", "10"},
+		{"5:10", "5:10"},
+		{"100:", "100:"},
+		{"~:3", "~:3"},
+		{"~:", "~:"},
+		{"@5:10", "@5:10"},
+		{"@~:-2", "@~:-2"},
+		{"0:", "0:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.threshold, func(t *testing.T) {
+			r, err := nagiosplugin.ParseRange(tt.threshold)
+			if err != nil {
+				t.Fatalf("ParseRange: %v", err)
+			}
+			if s := formatRange(r.String()); s != tt.expected {
+				t.Errorf("%v rendered as %v, expected %v", r.String(), s, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPerfDataSigmaRange(t *testing.T) {
+	warn, mode, err := parseThreshold("3sigma")
+	if err != nil {
+		t.Fatalf("parseThreshold: %v", err)
+	}
+	crit, _, _ := parseThreshold("100:")
+	nagios := nagiosplugin.NewCheck()
+	nagios.AddResult(nagiosplugin.OK, "test")
+	v, _ := nagiosplugin.NewFloatPerfDatumValue(1.5)
+	nagios.AddPerfDatum("errors sigma", "", v, rangeForMode(warn, mode, thresholdSigma), nil, nil, nil)
+	nagios.AddPerfDatum("errors", "c", v, nil, rangeForMode(crit, thresholdAbsolute, thresholdAbsolute), nil, nil)
+	expected := "OK: test | 'errors sigma'=1.5;~:3;;; 'errors'=1.5c;;100:;;"
+	if s := Output(nagios); s != expected {
+		t.Errorf("output %q, expected %q", s, expected)
+	}
+}
@@ -0,0 +1,64 @@
+package check
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ParseTime parses a point in time given on the command line. This is either
+// a timestamp in RFC3339 format or a duration like "24h", which is subtracted
+// from Now. An empty string returns Now.
+func ParseTime(Value string, Now time.Time) (time.Time, error) {
+	if Value == "" {
+		return Now, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, Value)
+	if err == nil {
+		return t, nil
+	}
+	d, derr := time.ParseDuration(Value)
+	if derr != nil {
+		return t, err
+	}
+	return Now.Add(-d), nil
+}
+
+// Formats a point in time as timestamp for the queries
+func formatTimestamp(Time time.Time) string {
+	return Time.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// Limits a query to documents with a @timestamp up to To by wrapping the
+// query into a bool query with an additional range filter. The placeholder
+// for the pagination is kept. Numbers are kept as they are written instead of
+// converting them to float64, which would round large integers.
+func limitQuery(Query string, To time.Time) (string, error) {
+	const placeholder = `"_pagination_":0`
+	q := strings.Replace(Query, "_PAGINATION_", placeholder, 1)
+	var body map[string]interface{}
+	d := json.NewDecoder(strings.NewReader(q))
+	d.UseNumber()
+	err := d.Decode(&body)
+	if err != nil {
+		return "", err
+	}
+	filter := []interface{}{
+		map[string]interface{}{
+			"range": map[string]interface{}{
+				"@timestamp": map[string]interface{}{"lte": formatTimestamp(To)},
+			},
+		},
+	}
+	if inner, ok := body["query"]; ok {
+		filter = append(filter, inner)
+	}
+	body["query"] = map[string]interface{}{
+		"bool": map[string]interface{}{"filter": filter},
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(string(b), placeholder, "_PAGINATION_", 1), nil
+}
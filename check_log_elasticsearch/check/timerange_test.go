@@ -0,0 +1,45 @@
+package check
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitQuery(t *testing.T) {
+	to := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		query    string
+		contains []string
+	}{
+		{
+			"large integer",
+			`{"query":{"range":{"event.sequence":{"gt":9007199254740993}}},_PAGINATION_}`,
+			[]string{`"gt":9007199254740993`, `"lte":"2024-01-01T12:00:00.000Z"`, `_PAGINATION_`},
+		},
+		{
+			"decimal",
+			`{"query":{"range":{"duration":{"gte":0.1}}},"size":1000,_PAGINATION_}`,
+			[]string{`"gte":0.1`, `"size":1000`},
+		},
+		{
+			"without query",
+			`{"sort":[{"@timestamp":{"order":"asc"}}],_PAGINATION_}`,
+			[]string{`"filter":[{"range":{"@timestamp":{"lte":"2024-01-01T12:00:00.000Z"}}}]`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := limitQuery(tt.query, to)
+			if err != nil {
+				t.Fatalf("limitQuery: %v", err)
+			}
+			for _, c := range tt.contains {
+				if !strings.Contains(q, c) {
+					t.Errorf("%v missing in %v", c, q)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package check
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Placeholders which are replaced in the queries
+var queryPlaceholders = map[string]string{
+	"_TIMESTAMP_":  "1900-01-01T00:00:00.000Z",
+	"_PAGINATION_": `"pit":{"id":"validate"},"size":1000`,
+}
+
+var (
+	queryPlaceholderRegex = regexp.MustCompile(`_[A-Z][A-Z0-9]*(?:_[A-Z0-9]+)*_`)
+	yamlLineRegex         = regexp.MustCompile(`line (\d+)`)
+	illegalMetricRegex    = regexp.MustCompile(`[\s'=]`)
+)
+
+// Where an action and its rules are defined
+type actionLocation struct {
+	file  string
+	node  *yaml.Node
+	rules map[string]*yaml.Node
+}
+
+// Validate checks the action file or all action files in the directory
+// without connecting to Elasticsearch. It checks the structure of the files
+// against the schema, resolves templates, pattern sets, includes and
+// matrices, and checks the regular expressions, thresholds, queries and metric
+// names of all actions. Returns all problems found.
+func Validate(ActionFile string) []Problem {
+	logger := log.With().Str("func", "Validate").Str("package", "check").Str("filename", ActionFile).Logger()
+	logger.Trace().Msg("Enter func")
+	var problems []Problem
+	files, err := actionFiles(ActionFile)
+	if err != nil {
+		return []Problem{{File: ActionFile, Message: err.Error()}}
+	}
+	l := &actionFileLoader{seen: make(map[string]bool)}
+	for _, file := range files {
+		err = l.load(file)
+		if err != nil {
+			problems = append(problems, errorProblem(file, err))
+		}
+	}
+	schema, err := newSchemaValidator()
+	if err != nil {
+		return append(problems, Problem{File: ActionFile, Message: "invalid schema: " + err.Error()})
+	}
+	for i := range l.documents {
+		problems = append(problems, schema.validate(l.documents[i].file, &l.documents[i].document)...)
+	}
+	actions, err := l.actions()
+	if err != nil {
+		// Errors in the structure usually cause follow-up errors here
+		if len(problems) == 0 {
+			problems = append(problems, errorProblem(ActionFile, err))
+		}
+		return sortProblems(problems)
+	}
+	locations := l.locations()
+	for _, a := range actions.Actions {
+		loc := locations[a.Name]
+		problems = append(problems, a.validate(loc)...)
+	}
+	logger.Debug().Str("id", "DBG20230001").Int("actions", len(actions.Actions)).Int("problems", len(problems)).Msg("Validated action files")
+	return sortProblems(problems)
+}
+
+// Converts an error into a problem. Errors of the YAML parser and of the
+// loader are prefixed with the file and contain the line.
+func errorProblem(File string, Err error) Problem {
+	message := Err.Error()
+	if i := strings.Index(message, ": "); i > 0 && strings.HasSuffix(message[:i], ".yaml") || i > 0 && strings.HasSuffix(message[:i], ".yml") {
+		File = message[:i]
+		message = message[i+2:]
+	}
+	p := Problem{File: File, Message: message}
+	if m := yamlLineRegex.FindStringSubmatch(message); m != nil {
+		p.Line, _ = strconv.Atoi(m[1])
+	}
+	return p
+}
+
+// Sorts the problems by file and line
+func sortProblems(Problems []Problem) []Problem {
+	sort.SliceStable(Problems, func(i, j int) bool {
+		if Problems[i].File != Problems[j].File {
+			return Problems[i].File < Problems[j].File
+		}
+		return Problems[i].Line < Problems[j].Line
+	})
+	return Problems
+}
+
+// Returns where the actions and their rules are defined. This uses the
+// documents after templates and matrices have been resolved.
+func (l *actionFileLoader) locations() map[string]actionLocation {
+	locations := make(map[string]actionLocation)
+	for _, d := range l.documents {
+		if len(d.document.Content) == 0 {
+			continue
+		}
+		actions := mappingValue(d.document.Content[0], "actions")
+		if actions == nil {
+			continue
+		}
+		for _, a := range actions.Content {
+			name := mappingValue(a, "name")
+			if name == nil {
+				continue
+			}
+			loc := actionLocation{file: d.file, node: a, rules: make(map[string]*yaml.Node)}
+			if rules := mappingValue(a, "rules"); rules != nil {
+				for i := 0; i+1 < len(rules.Content); i += 2 {
+					loc.rules[rules.Content[i].Value] = rules.Content[i+1]
+				}
+			}
+			locations[name.Value] = loc
+		}
+	}
+	return locations
+}
+
+// Returns the line of the first scalar with the given value below the node or
+// the line of the node itself
+func findLine(Node *yaml.Node, Value string) int {
+	if Node == nil {
+		return 0
+	}
+	var find func(n *yaml.Node) int
+	find = func(n *yaml.Node) int {
+		if n.Kind == yaml.ScalarNode && n.Value == Value {
+			return n.Line
+		}
+		for _, c := range n.Content {
+			if l := find(c); l > 0 {
+				return l
+			}
+		}
+		return 0
+	}
+	if l := find(Node); l > 0 {
+		return l
+	}
+	return Node.Line
+}
+
+// Validates the query, metric names and rules of an action
+func (a Action) validate(Location actionLocation) []Problem {
+	var problems []Problem
+	add := func(Node *yaml.Node, Value string, Format string, Args ...interface{}) {
+		problems = append(problems, Problem{
+			File:    Location.file,
+			Line:    findLine(Node, Value),
+			Message: fmt.Sprintf("action %v: ", a.Name) + fmt.Sprintf(Format, Args...),
+		})
+	}
+	for _, err := range validateQuery(a.Query) {
+		add(mappingValue(Location.node, "query"), "", "query: %v", err)
+	}
+	if err := validateMetricName(a.Name); err != nil {
+		add(mappingValue(Location.node, "name"), "", "%v", err)
+	}
+	metrics := make(map[string]string)
+	names := make([]string, 0, len(a.Rules))
+	for rulename := range a.Rules {
+		names = append(names, rulename)
+	}
+	sort.Strings(names)
+	for _, rulename := range names {
+		rule := a.Rules[rulename]
+		node := Location.rules[rulename]
+		metric := rule.MetricName
+		if metric == "" {
+			metric = rulename
+		}
+		if err := validateMetricName(metric); err != nil {
+			add(node, metric, "rule %v: %v", rulename, err)
+		}
+		if other, ok := metrics[metric]; ok {
+			add(node, metric, "rule %v: metric name %v is already used by rule %v", rulename, metric, other)
+		}
+		metrics[metric] = rulename
+		for _, p := range rule.validate() {
+			add(node, p.value, "rule %v: %v", rulename, p.err)
+		}
+	}
+	maintenance := mappingValue(Location.node, "maintenance")
+	for _, m := range a.Maintenance {
+		if err := m.init(); err != nil {
+			add(maintenance, m.key(), "maintenance: %v", err)
+		}
+	}
+	tests := mappingValue(Location.node, "tests")
+	for i, t := range a.Tests {
+		var node *yaml.Node
+		if tests != nil && i < len(tests.Content) {
+			node = tests.Content[i]
+		}
+		if len(t.Documents) == 0 {
+			add(node, "", "test %v has no documents", i+1)
+		}
+		for _, name := range t.Expect {
+			if _, ok := a.Rules[name]; !ok && name != expectNone {
+				add(node, name, "test %v expects unknown rule %v", i+1, name)
+			}
+		}
+		if _, err := t.hits(); err != nil {
+			add(node, "", "test %v: %v", i+1, err)
+		}
+	}
+	return problems
+}
+
+// Checks the query of an action. It must contain the placeholders _TIMESTAMP_
+// and _PAGINATION_ and be valid JSON after replacing them.
+func validateQuery(Query string) []error {
+	var errs []error
+	q := Query
+	for placeholder, value := range queryPlaceholders {
+		if !strings.Contains(Query, placeholder) {
+			errs = append(errs, errors.New("placeholder "+placeholder+" is missing"))
+		}
+		q = strings.ReplaceAll(q, placeholder, value)
+	}
+	for _, p := range queryPlaceholderRegex.FindAllString(q, -1) {
+		errs = append(errs, errors.New("unknown placeholder "+p))
+	}
+	var body interface{}
+	if err := json.Unmarshal([]byte(q), &body); err != nil {
+		errs = append(errs, fmt.Errorf("invalid JSON: %v", err))
+	}
+	return errs
+}
+
+// Checks, if a metric name can be used in the performance data
+func validateMetricName(Name string) error {
+	if Name == "" {
+		return errors.New("metric name is empty")
+	}
+	if illegalMetricRegex.MatchString(Name) {
+		return fmt.Errorf("metric name %q must not contain whitespace, ' or =", Name)
+	}
+	return nil
+}
+
+// A problem of a rule and the value in the action file causing it
+type ruleProblem struct {
+	value string
+	err   error
+}
+
+// Validates a rule the same way NewCheck initializes it, but returns all
+// problems instead of stopping at the first one
+func (rule Rule) validate() []ruleProblem {
+	var problems []ruleProblem
+	add := func(Value string, Err error) {
+		if Err != nil {
+			problems = append(problems, ruleProblem{value: Value, err: Err})
+		}
+	}
+	_, _, err := parseThreshold(rule.Warning)
+	add(rule.Warning, wrapError("warning", err))
+	_, _, err = parseThreshold(rule.Critical)
+	add(rule.Critical, wrapError("critical", err))
+	_, err = parseRateUnit(rule.Rate)
+	add(rule.Rate, wrapError("rate", err))
+	if rule.DistinctField != "" && rule.ValueField != "" {
+		add(rule.ValueField, errors.New("distinct_field and value_field are mutually exclusive"))
+	}
+	rule.statistic, rule.quantile, err = parseStatistic(rule.Statistic)
+	add(rule.Statistic, wrapError("statistic", err))
+	add(rule.Type, wrapError("type", rule.initType()))
+	add(rule.BaselineWarmup, wrapError("baseline_warmup", rule.initBaseline()))
+	add(rule.DedupeWindow, wrapError("dedupe_window", rule.initDedupe()))
+	for _, s := range rule.ThresholdSchedules {
+		add(s.key(), wrapError("threshold_schedules", s.init(rule.Warning, rule.Critical)))
+	}
+	for _, m := range rule.Maintenance {
+		add(m.key(), wrapError("maintenance", m.init()))
+	}
+	for _, p := range rule.patterns() {
+		_, err := regexp.Compile(p.Regex)
+		add(p.Regex, wrapError("regex", err))
+	}
+	return problems
+}
+
+// Prefixes an error with the name of the field causing it
+func wrapError(Field string, Err error) error {
+	if Err == nil {
+		return nil
+	}
+	return fmt.Errorf("%v: %v", Field, Err)
+}
+
+// Returns all patterns used by a rule including the ones of its type
+// specific configuration
+func (rule Rule) patterns() []Pattern {
+	patterns := append([]Pattern{}, rule.Pattern...)
+	patterns = append(patterns, rule.Exclude...)
+	if rule.Sequence != nil {
+		for _, step := range rule.Sequence.Steps {
+			patterns = append(patterns, step.Pattern...)
+			patterns = append(patterns, step.Exclude...)
+		}
+	}
+	if rule.Latency != nil {
+		patterns = append(patterns, rule.Latency.Start...)
+		patterns = append(patterns, rule.Latency.End...)
+	}
+	return patterns
+}
@@ -3,11 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/joernott/nagiosplugin/v2"
 
 	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
-	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -19,6 +19,8 @@ var checkCmd = &cobra.Command{
 	Short: "Check logs",
 	Long:  `Check logs in elasticsearch`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindConnectionFlags(cmd)
+		bindFlags(cmd, "from", "to")
 		setupLogging()
 		err := HandleConfigFile()
 		if err != nil {
@@ -34,23 +36,7 @@ var checkCmd = &cobra.Command{
 		nagios.SetVerbosity(nagiosplugin.VERBOSITY_MULTI_LINE)
 		defer nagios.Finish()
 
-		parsedTimeout, err := parseTimeout(viper.GetString("timeout"))
-		if err != nil {
-			nagios.AddResult(nagiosplugin.UNKNOWN, "Could not parse timeout")
-			return
-		}
-
-		elasticsearch, err := elasticsearch.NewElasticsearch(
-			viper.GetBool("ssl"),
-			viper.GetString("host"),
-			viper.GetInt("port"),
-			viper.GetString("user"),
-			viper.GetString("password"),
-			viper.GetBool("validatessl"),
-			viper.GetString("proxy"),
-			viper.GetBool("socks"),
-			parsedTimeout,
-		)
+		connection, err := newConnection()
 		if err != nil {
 			nagios.AddResult(nagiosplugin.UNKNOWN, "Could not create connection to Elasticsearch")
 			log.Fatal().Err(err).Msg("Could not create connection to Elasticsearch")
@@ -59,21 +45,48 @@ var checkCmd = &cobra.Command{
 		}
 
 		if viper.GetBool("showcommand") {
-			command = os.Args[0] + " handle -f "+ viper.GetString("actionfile")
+			command = os.Args[0] + " handle "+actionSourceFlag()
 		}
-		c, err = check.NewCheck(viper.GetString("actionfile"), elasticsearch, nagios, command)
+		c, err = check.NewCheck(actionSource(), connection, nagios, command)
 		if err != nil {
 			nagios.AddResult(nagiosplugin.UNKNOWN, "Could not create check")
 			log.Fatal().Err(err).Msg("Could not create check")
 			nagios.Finish()
 			return
 		}
+		c.DryRun = viper.GetBool("dry-run")
+		if viper.GetString("from") != "" {
+			now := time.Now()
+			from, err := check.ParseTime(viper.GetString("from"), now)
+			if err != nil {
+				nagios.AddResult(nagiosplugin.UNKNOWN, "Could not parse start of the time range: "+err.Error())
+				nagios.Finish()
+				return
+			}
+			to, err := check.ParseTime(viper.GetString("to"), now)
+			if err != nil {
+				nagios.AddResult(nagiosplugin.UNKNOWN, "Could not parse end of the time range: "+err.Error())
+				nagios.Finish()
+				return
+			}
+			if !from.Before(to) {
+				nagios.AddResult(nagiosplugin.UNKNOWN, "The start of the time range must be before its end")
+				nagios.Finish()
+				return
+			}
+			c.Replay(from, to)
+		} else if viper.GetString("to") != "" {
+			nagios.AddResult(nagiosplugin.UNKNOWN, "The end of the time range requires a start given with --from")
+			nagios.Finish()
+			return
+		}
 		err = c.Execute(viper.GetStringSlice("action"))
 		if err != nil {
+			check.Finish(nagios)
 			return
 		}
 		log.Info().Msg("Check finished successfully")
-		nagios.Finish()
+		check.Finish(nagios)
 		return
 	},
 }
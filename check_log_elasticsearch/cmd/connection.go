@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The names of the flags for the connection to Elasticsearch
+var connectionFlags = []string{"ssl", "validatessl", "host", "port", "user", "password", "proxy", "socks", "timeout"}
+
+// Adds the flags for the connection to Elasticsearch to a subcommand
+func addConnectionFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVarP(&UseSSL, "ssl", "s", true, "Use SSL")
+	cmd.PersistentFlags().BoolVarP(&ValidateSSL, "validatessl", "v", true, "Validate SSL certificate")
+	cmd.PersistentFlags().StringVarP(&Host, "host", "H", "localhost", "Hostname of the server")
+	cmd.PersistentFlags().IntVarP(&Port, "port", "P", 9200, "Network port")
+	cmd.PersistentFlags().StringVarP(&User, "user", "u", "", "Username for Elasticsearch")
+	cmd.PersistentFlags().StringVarP(&Password, "password", "p", "", "Password for the Elasticsearch user (consider using the env variable CLE_PASSWORD instead of passing it via commandline)")
+	cmd.PersistentFlags().StringVarP(&Proxy, "proxy", "y", "", "Proxy (defaults to none)")
+	cmd.PersistentFlags().BoolVarP(&ProxyIsSocks, "socks", "Y", false, "This is a SOCKS proxy")
+	cmd.PersistentFlags().StringVarP(&Timeout, "timeout", "T", "2m", "Timeout understood by time.ParseDuration")
+}
+
+// Binds the connection flags of the subcommand being executed to the viper
+// configuration.
+func bindConnectionFlags(cmd *cobra.Command) {
+	bindFlags(cmd, connectionFlags...)
+}
+
+// Creates the connection to Elasticsearch from the configuration
+func newConnection() (*elasticsearch.Elasticsearch, error) {
+	parsedTimeout, err := parseTimeout(viper.GetString("timeout"))
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearch.NewElasticsearch(
+		viper.GetBool("ssl"),
+		viper.GetString("host"),
+		viper.GetInt("port"),
+		viper.GetString("user"),
+		viper.GetString("password"),
+		viper.GetBool("validatessl"),
+		viper.GetString("proxy"),
+		viper.GetBool("socks"),
+		parsedTimeout,
+	)
+}
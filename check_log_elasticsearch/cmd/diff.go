@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/elasticsearch"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The subcommand "diff" compares the results of two versions of an action file
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the results of two action files",
+	Long: `Evaluates documents with the rules of the action file (old) and of the file given with --new and prints the differences of the counts per rule, the documents counted for other rules and the Nagios states.
+The documents are read from an NDJSON file given with --input or queried from Elasticsearch for the time range given with --from and --to using the query of each action.
+The status files are neither read nor written. Exits with 1 if the Nagios state of an action changes.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindConnectionFlags(cmd)
+		bindFlags(cmd, "input", "from", "to", "top")
+		setupLogging()
+		err := HandleConfigFile()
+		if err != nil {
+			fmt.Println("Config error")
+			panic(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var connection *elasticsearch.Elasticsearch
+		var source *check.DiffSource
+
+		if viper.GetString("new") == "" {
+			fmt.Println("The new action file must be given with --new")
+			os.Exit(2)
+		}
+		if viper.GetString("input") != "" {
+			input, name, err := openInput(viper.GetString("input"))
+			if err != nil {
+				fmt.Println("Could not open documents: " + err.Error())
+				os.Exit(2)
+			}
+			source, err = check.NewDiffSource(input, name)
+			input.Close()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		} else {
+			now := time.Now()
+			from, err := check.ParseTime(viper.GetString("from"), now)
+			if err != nil {
+				fmt.Println("Could not parse start of the time range: " + err.Error())
+				os.Exit(2)
+			}
+			to, err := check.ParseTime(viper.GetString("to"), now)
+			if err != nil {
+				fmt.Println("Could not parse end of the time range: " + err.Error())
+				os.Exit(2)
+			}
+			source = &check.DiffSource{From: from, To: to}
+			connection, err = newConnection()
+			if err != nil {
+				log.Fatal().Err(err).Msg("Could not create connection to Elasticsearch")
+				os.Exit(2)
+			}
+		}
+		old, err := check.NewCheck(actionSource(), connection, nil, "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check for the old action file")
+			os.Exit(2)
+		}
+		updated, err := check.NewCheck(viper.GetString("new"), connection, nil, "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check for the new action file")
+			os.Exit(2)
+		}
+		changed, err := old.Diff(updated, viper.GetStringSlice("action"), source, viper.GetInt("top"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if changed {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The subcommand "explain" shows how the rules of an action evaluate a single
+// document
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain the evaluation of a document",
+	Long: `Fetches a single document from Elasticsearch and prints how the rules of an action evaluate it.
+The values of the fields used by the rules, the result of every pattern and exclude and the effect of use_and and stop_on_match are shown in the order of the rules.
+The status file is neither read nor written.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindConnectionFlags(cmd)
+		setupLogging()
+		err := HandleConfigFile()
+		if err != nil {
+			fmt.Println("Config error")
+			panic(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		actions := viper.GetStringSlice("action")
+		if len(actions) != 1 {
+			fmt.Println("Exactly one action must be given with --action")
+			os.Exit(2)
+		}
+		if viper.GetString("id") == "" {
+			fmt.Println("The id of the document must be given with --id")
+			os.Exit(2)
+		}
+		connection, err := newConnection()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not create connection to Elasticsearch")
+			os.Exit(2)
+		}
+		c, err := check.NewCheck(actionSource(), connection, nil, "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
+			os.Exit(2)
+		}
+		err = c.Explain(actions[0], viper.GetString("id"), viper.GetString("index"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	},
+}
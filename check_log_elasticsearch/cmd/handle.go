@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
 	"github.com/rs/zerolog/log"
@@ -11,12 +12,14 @@ import (
 )
 
 // The subcommand "handle" is called manually to set historic entries to
-// "handled"
+// "handled" or back to "not handled"
 var handleCmd = &cobra.Command{
 	Use:   "handle",
 	Short: "Handle a history entry",
-	Long:  `Mark a history entry with the provided uuid as handled`,
+	Long: `Mark a history entry with the provided uuid as handled.
+The author, the comment and the time are recorded in the status file. With --unhandle, the entry is set back to not handled and reported again.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindFlags(cmd, "uuid", "all")
 		setupLogging()
 		err := HandleConfigFile()
 		if err != nil {
@@ -27,15 +30,33 @@ var handleCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		var c *check.Check
 
-		c, err := check.NewCheck(viper.GetString("actionfile"), nil, nil, "")
+		c, err := check.NewCheck(actionSource(), nil, nil, "")
 		if err != nil {
 			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
 			os.Exit(2)
 		}
-		err = c.HandleHistory(viper.GetStringSlice("action"), viper.GetStringSlice("uuid"), viper.GetBool("all"))
+		ack := check.Acknowledgement{
+			Handled:   !viper.GetBool("unhandle"),
+			Author:    handleAuthor(),
+			Comment:   viper.GetString("comment"),
+			HandledAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		err = c.HandleHistory(viper.GetStringSlice("action"), viper.GetStringSlice("uuid"), viper.GetBool("all"), ack)
 		if err != nil {
 			os.Exit(2)
 		}
 		return
 	},
 }
+
+// Returns the author given on the command line or the user calling the
+// command, preferring the user who called sudo
+func handleAuthor() string {
+	if a := viper.GetString("author"); a != "" {
+		return a
+	}
+	if a := os.Getenv("SUDO_USER"); a != "" {
+		return a
+	}
+	return os.Getenv("USER")
+}
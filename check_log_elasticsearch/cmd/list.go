@@ -28,9 +28,9 @@ var listCmd = &cobra.Command{
 		var command string
 
 		if viper.GetBool("showcommand") {
-			command = os.Args[0] + " handle -f "+ viper.GetString("actionfile")
+			command = os.Args[0] + " handle "+actionSourceFlag()
 		}
-		c, err := check.NewCheck(viper.GetString("actionfile"), nil, nil, command)
+		c, err := check.NewCheck(actionSource(), nil, nil, command)
 		if err != nil {
 			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
 			os.Exit(2)
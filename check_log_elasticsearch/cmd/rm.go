@@ -15,6 +15,7 @@ var rmCmd = &cobra.Command{
 	Short: "Remove a history entry",
 	Long:  `Removes a history entry with the provided uuid from a status`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindFlags(cmd, "uuid", "all")
 		setupLogging()
 		err := HandleConfigFile()
 		if err != nil {
@@ -25,7 +26,7 @@ var rmCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		var c *check.Check
 
-		c, err := check.NewCheck(viper.GetString("actionfile"), nil, nil, "")
+		c, err := check.NewCheck(actionSource(), nil, nil, "")
 		if err != nil {
 			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
 			os.Exit(2)
@@ -49,6 +49,10 @@ var LogFile string
 // Global variable for cobra, name of the config file describing the actions
 var ActionFile string
 
+// Global variable for cobra, directory containing action files. If set, all
+// action files in it are read instead of the action file
+var ActionDir string
+
 // Global variable for cobra, list of actions to execute. If empty, all actions
 // will be executed
 var Action []string
@@ -95,6 +99,74 @@ var ShowCommand bool
 // Global variable for cobra, timestamp for the init function to use as start
 var Timestamp string
 
+// Global variable for cobra, start of the time range (suggest subcommand)
+var From string
+
+// Global variable for cobra, end of the time range (suggest subcommand)
+var To string
+
+// Global variable for cobra, number of suggestions (suggest subcommand)
+var Top int
+
+// Global variable for cobra, field containing the message (suggest subcommand)
+var Field string
+
+// Global variable for cobra, similarity for merging templates (suggest subcommand)
+var Similarity float64
+
+// Global variable for cobra, print the JSON Schema (validate subcommand)
+var Schema bool
+
+// Global variable for cobra, NDJSON file with documents (test subcommand)
+var Input string
+
+// Global variable for cobra, output format (selftest subcommand)
+var Format string
+
+// Global variable for cobra, the new action file or directory (diff subcommand)
+var NewActionFile string
+
+// Global variable for cobra, NDJSON file with documents (diff subcommand). The
+// flags of the subcommands need their own variables, as pflag uses the
+// current value of the variable as default.
+var DiffInput string
+
+// Global variable for cobra, number of changed documents listed (diff subcommand)
+var DiffTop int
+
+// Global variable for cobra, don't save the status files (check subcommand)
+var DryRun bool
+
+// Global variable for cobra, rules to snooze (snooze subcommand)
+var SnoozeRules []string
+
+// Global variable for cobra, end of the snooze (snooze subcommand)
+var SnoozeUntil string
+
+// Global variable for cobra, duration of the snooze (snooze subcommand)
+var SnoozeFor string
+
+// Global variable for cobra, who handles the entries (handle subcommand)
+var HandleAuthor string
+
+// Global variable for cobra, why the entries are handled (handle subcommand)
+var HandleComment string
+
+// Global variable for cobra, set the entries back to not handled (handle subcommand)
+var Unhandle bool
+
+// Global variable for cobra, start of the time range to replay (check subcommand)
+var ReplayFrom string
+
+// Global variable for cobra, end of the time range to replay (check subcommand)
+var ReplayTo string
+
+// Global variable for cobra, id of the document (explain subcommand)
+var DocumentId string
+
+// Global variable for cobra, index of the document (explain subcommand)
+var Index string
+
 // Run the checkcommand
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -109,37 +181,73 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&LogLevel, "loglevel", "l", "WARN", "Log level")
 	rootCmd.PersistentFlags().StringVarP(&LogFile, "logfile", "L", "/var/log/icinga2/check_log_elasticsearch.log", "Log file (use - to log to stdout)")
 	rootCmd.PersistentFlags().StringVarP(&ActionFile, "actionfile", "f", "/etc/icinga2/check_log_elasticsearch/actions.yaml", "Action file")
+	rootCmd.PersistentFlags().StringVarP(&ActionDir, "actiondir", "D", "", "Directory containing action files, all *.yaml and *.yml files in it are read instead of the action file")
 	rootCmd.PersistentFlags().StringSliceVarP(&Action, "action", "a", []string{}, "Name(s) of action(s) to run (can be used multiple times, default is all, if no explicit actions are specified)")
 	rootCmd.PersistentFlags().BoolVarP(&ShowCommand, "showcommand", "C", false, "Show the commands for handle etc.")
 
-	checkCmd.PersistentFlags().BoolVarP(&UseSSL, "ssl", "s", true, "Use SSL")
-	checkCmd.PersistentFlags().BoolVarP(&ValidateSSL, "validatessl", "v", true, "Validate SSL certificate")
-	checkCmd.PersistentFlags().StringVarP(&Host, "host", "H", "localhost", "Hostname of the server")
-	checkCmd.PersistentFlags().IntVarP(&Port, "port", "P", 9200, "Network port")
-	checkCmd.PersistentFlags().StringVarP(&User, "user", "u", "", "Username for Elasticsearch")
-	checkCmd.PersistentFlags().StringVarP(&Password, "password", "p", "", "Password for the Elasticsearch user (consider using the env variable CLE_PASSWORD instead of passing it via commandline)")
-	checkCmd.PersistentFlags().StringVarP(&Proxy, "proxy", "y", "", "Proxy (defaults to none)")
-	checkCmd.PersistentFlags().BoolVarP(&ProxyIsSocks, "socks", "Y", false, "This is a SOCKS proxy")
-	checkCmd.PersistentFlags().StringVarP(&Timeout, "timeout", "T", "2m", "Timeout understood by time.ParseDuration")
+	addConnectionFlags(checkCmd)
+	checkCmd.PersistentFlags().BoolVarP(&DryRun, "dry-run", "d", false, "Run the check without saving the status files")
+	checkCmd.PersistentFlags().StringVarP(&ReplayFrom, "from", "F", "", "Replay the time range starting at this time in RFC3339 format or as duration before now instead of continuing at the timestamp in the status file")
+	checkCmd.PersistentFlags().StringVarP(&ReplayTo, "to", "t", "", "End of the time range to replay in RFC3339 format or as duration before now, defaults to now")
 
 	handleCmd.PersistentFlags().StringSliceVarP(&Uuid, "uuid", "U", []string{}, "Clear entry with the given uuid from history")
 	rmCmd.PersistentFlags().StringSliceVarP(&Uuid, "uuid", "U", []string{}, "Remove entry with the given uuid from history")
 	handleCmd.PersistentFlags().BoolVarP(&All, "all", "A", false, "Clear all entries from history")
 	rmCmd.PersistentFlags().BoolVarP(&All, "all", "A", false, "Remove all entries from history")
+	handleCmd.PersistentFlags().StringVar(&HandleAuthor, "author", "", "Name of the person handling the entries, defaults to $SUDO_USER or $USER")
+	handleCmd.PersistentFlags().StringVarP(&HandleComment, "comment", "m", "", "Reason for handling the entries")
+	handleCmd.PersistentFlags().BoolVar(&Unhandle, "unhandle", false, "Set the entries back to not handled")
+
+	snoozeCmd.PersistentFlags().StringSliceVarP(&Uuid, "uuid", "U", []string{}, "Snooze the history entry with the given uuid")
+	snoozeCmd.PersistentFlags().StringSliceVarP(&SnoozeRules, "rule", "r", []string{}, "Snooze the rule with the given name, optionally followed by a group in brackets")
+	snoozeCmd.PersistentFlags().StringVarP(&SnoozeUntil, "until", "t", "", "End of the snooze in RFC3339 format")
+	snoozeCmd.PersistentFlags().StringVarP(&SnoozeFor, "for", "d", "", "Duration of the snooze understood by time.ParseDuration, e.g. 4h")
 
 	listCmd.PersistentFlags().BoolVarP(&HighlightUuid, "highlight", "i", false, "Highlight UUID")
 
 	initCmd.PersistentFlags().StringVarP(&Timestamp, "timestamp", "t", "2m", "Timestamp in RFC3339 format, defaults to the current date/time")
 
+	addConnectionFlags(suggestCmd)
+	suggestCmd.PersistentFlags().StringVarP(&From, "from", "F", "24h", "Start of the time range in RFC3339 format or as duration before now")
+	suggestCmd.PersistentFlags().StringVarP(&To, "to", "t", "", "End of the time range in RFC3339 format or as duration before now, defaults to now")
+	suggestCmd.PersistentFlags().IntVarP(&Top, "top", "n", 10, "Number of rules to suggest")
+	suggestCmd.PersistentFlags().StringVarP(&Field, "field", "m", "message", "Field containing the message")
+	suggestCmd.PersistentFlags().Float64VarP(&Similarity, "similarity", "S", 0.6, "Minimum share of equal tokens to merge messages into a template")
+
+	validateCmd.PersistentFlags().BoolVarP(&Schema, "schema", "j", false, "Print the JSON Schema of the action file instead of validating it")
+
+	testCmd.PersistentFlags().StringVarP(&Input, "input", "i", "-", "NDJSON file with one document per line, use - to read from stdin")
+
+	selftestCmd.PersistentFlags().StringVarP(&Format, "format", "o", "tap", "Output format, tap or junit")
+
+	addConnectionFlags(diffCmd)
+	diffCmd.PersistentFlags().StringVarP(&NewActionFile, "new", "N", "", "The new action file or directory to compare the action file with")
+	diffCmd.PersistentFlags().StringVarP(&DiffInput, "input", "i", "", "NDJSON file with one document per line, use - to read from stdin. If not given, the documents are queried from Elasticsearch")
+	diffCmd.PersistentFlags().StringVarP(&From, "from", "F", "24h", "Start of the time range in RFC3339 format or as duration before now")
+	diffCmd.PersistentFlags().StringVarP(&To, "to", "t", "", "End of the time range in RFC3339 format or as duration before now, defaults to now")
+	diffCmd.PersistentFlags().IntVarP(&DiffTop, "top", "n", 20, "Maximum number of documents counted for other rules to list per action, 0 lists all")
+
+	addConnectionFlags(explainCmd)
+	explainCmd.PersistentFlags().StringVarP(&DocumentId, "id", "I", "", "Id of the document")
+	explainCmd.PersistentFlags().StringVarP(&Index, "index", "x", "", "Index containing the document, defaults to the index of the action")
+
 	rootCmd.AddCommand(checkCmd)
 	rootCmd.AddCommand(handleCmd)
 	rootCmd.AddCommand(rmCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(suggestCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(testCmd)
+	rootCmd.AddCommand(selftestCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(explainCmd)
+	rootCmd.AddCommand(snoozeCmd)
 
 	viper.SetDefault("loglevel", "WARN")
 	viper.SetDefault("logfile", "/var/log/icinga2/check_log_elasticsearch.log")
 	viper.SetDefault("actionfile", "/etc/icinga2/check_log_elasticsearch/actions.yaml")
+	viper.SetDefault("actiondir", "")
 	viper.SetDefault("action", "")
 	viper.SetDefault("showcommand", false)
 
@@ -160,31 +268,47 @@ func init() {
 
 	viper.SetDefault("timestamp", "")
 
+	viper.SetDefault("to", "")
+	viper.SetDefault("field", "message")
+	viper.SetDefault("similarity", 0.6)
+
 	viper.BindPFlag("loglevel", rootCmd.PersistentFlags().Lookup("loglevel"))
 	viper.BindPFlag("logfile", rootCmd.PersistentFlags().Lookup("logfile"))
 	viper.BindPFlag("actionfile", rootCmd.PersistentFlags().Lookup("actionfile"))
+	viper.BindPFlag("actiondir", rootCmd.PersistentFlags().Lookup("actiondir"))
 	viper.BindPFlag("action", rootCmd.PersistentFlags().Lookup("action"))
 	viper.BindPFlag("showcommand", rootCmd.PersistentFlags().Lookup("showcommand"))
 
-	viper.BindPFlag("ssl", checkCmd.PersistentFlags().Lookup("ssl"))
-	viper.BindPFlag("validatessl", checkCmd.PersistentFlags().Lookup("validatessl"))
-	viper.BindPFlag("host", checkCmd.PersistentFlags().Lookup("host"))
-	viper.BindPFlag("port", checkCmd.PersistentFlags().Lookup("port"))
-	viper.BindPFlag("user", checkCmd.PersistentFlags().Lookup("user"))
-	viper.BindPFlag("password", checkCmd.PersistentFlags().Lookup("password"))
-	viper.BindPFlag("proxy", checkCmd.PersistentFlags().Lookup("proxy"))
-	viper.BindPFlag("socks", checkCmd.PersistentFlags().Lookup("socks"))
-	viper.BindPFlag("timeout", checkCmd.PersistentFlags().Lookup("timeout"))
+	viper.BindPFlag("dry-run", checkCmd.PersistentFlags().Lookup("dry-run"))
 
 	viper.BindPFlag("uuid", handleCmd.PersistentFlags().Lookup("uuid"))
 	viper.BindPFlag("uuid", rmCmd.PersistentFlags().Lookup("uuid"))
 	viper.BindPFlag("all", handleCmd.PersistentFlags().Lookup("all"))
 	viper.BindPFlag("all", rmCmd.PersistentFlags().Lookup("all"))
+	viper.BindPFlag("author", handleCmd.PersistentFlags().Lookup("author"))
+	viper.BindPFlag("comment", handleCmd.PersistentFlags().Lookup("comment"))
+	viper.BindPFlag("unhandle", handleCmd.PersistentFlags().Lookup("unhandle"))
+
+	viper.BindPFlag("rule", snoozeCmd.PersistentFlags().Lookup("rule"))
+	viper.BindPFlag("until", snoozeCmd.PersistentFlags().Lookup("until"))
+	viper.BindPFlag("for", snoozeCmd.PersistentFlags().Lookup("for"))
 
 	viper.BindPFlag("highlight", listCmd.PersistentFlags().Lookup("highlight"))
 
 	viper.BindPFlag("timestamp", initCmd.PersistentFlags().Lookup("timestamp"))
 
+	viper.BindPFlag("field", suggestCmd.PersistentFlags().Lookup("field"))
+	viper.BindPFlag("similarity", suggestCmd.PersistentFlags().Lookup("similarity"))
+
+	viper.BindPFlag("schema", validateCmd.PersistentFlags().Lookup("schema"))
+
+	viper.BindPFlag("format", selftestCmd.PersistentFlags().Lookup("format"))
+
+	viper.BindPFlag("new", diffCmd.PersistentFlags().Lookup("new"))
+
+	viper.BindPFlag("id", explainCmd.PersistentFlags().Lookup("id"))
+	viper.BindPFlag("index", explainCmd.PersistentFlags().Lookup("index"))
+
 	viper.SetEnvPrefix("cle")
 	viper.BindEnv("password")
 }
@@ -244,6 +368,33 @@ func setupLogging() {
 	log.Debug().Str("id", "DBG00001").Str("func", "setupLogging").Str("logfile", LogFile).Msg("Logging to " + LogFile)
 }
 
+// Binds the flags with the given names of the subcommand being executed to
+// the viper configuration. This is done when the subcommand runs for flags
+// which are shared by several subcommands.
+func bindFlags(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		viper.BindPFlag(name, cmd.PersistentFlags().Lookup(name))
+	}
+}
+
+// Returns the action directory, if one is configured, otherwise the action
+// file
+func actionSource() string {
+	if viper.GetString("actiondir") != "" {
+		return viper.GetString("actiondir")
+	}
+	return viper.GetString("actionfile")
+}
+
+// Returns the command line flag for the action directory or file to be used
+// in the commands shown to the user
+func actionSourceFlag() string {
+	if viper.GetString("actiondir") != "" {
+		return "-D " + viper.GetString("actiondir")
+	}
+	return "-f " + viper.GetString("actionfile")
+}
+
 // Parse the timeout string into a go duration
 func parseTimeout(timeout string) (time.Duration, error) {
 	logger := log.With().Str("func", "rootCmd.parseTimeout").Str("package", "cmd").Logger()
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The subcommand "selftest" runs the tests defined in the action files
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Run the tests of the actions",
+	Long: `Runs the sample documents of the tests defined in the actions through their rules and checks, that every document is counted for the expected rules.
+The results are printed in TAP or JUnit XML format. Elasticsearch is not contacted and the status files are neither read nor written.
+Exits with 1 if a test failed and with 2 on errors.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		setupLogging()
+		err := HandleConfigFile()
+		if err != nil {
+			fmt.Println("Config error")
+			panic(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := check.NewCheck(actionSource(), nil, nil, "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
+			os.Exit(2)
+		}
+		failed, err := c.SelfTest(viper.GetStringSlice("action"), viper.GetString("format"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
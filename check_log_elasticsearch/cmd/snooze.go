@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The subcommand "snooze" is called manually to silence history entries,
+// rules or actions for some time
+var snoozeCmd = &cobra.Command{
+	Use:   "snooze",
+	Short: "Silence history entries, rules or actions for some time",
+	Long: `Silence the history entries with the given uuids, the given rules or the given actions until a point in time or for a duration.
+While snoozed, history entries are not reported and rules report OK without creating history entries. Snoozes expire automatically.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindFlags(cmd, "uuid")
+		setupLogging()
+		err := HandleConfigFile()
+		if err != nil {
+			fmt.Println("Config error")
+			panic(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var c *check.Check
+		var until time.Time
+
+		switch {
+		case viper.GetString("until") != "" && viper.GetString("for") != "":
+			fmt.Println("UNKNOWN: Use either --until or --for")
+			os.Exit(2)
+		case viper.GetString("until") != "":
+			t, err := time.Parse(time.RFC3339, viper.GetString("until"))
+			if err != nil {
+				fmt.Println("UNKNOWN: Could not parse --until: " + err.Error())
+				os.Exit(2)
+			}
+			until = t
+		case viper.GetString("for") != "":
+			d, err := time.ParseDuration(viper.GetString("for"))
+			if err != nil || d <= 0 {
+				fmt.Printf("UNKNOWN: Invalid duration %v\n", viper.GetString("for"))
+				os.Exit(2)
+			}
+			until = time.Now().Add(d)
+		default:
+			fmt.Println("UNKNOWN: Give the end of the snooze with --until or --for")
+			os.Exit(2)
+		}
+
+		c, err := check.NewCheck(actionSource(), nil, nil, "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
+			os.Exit(2)
+		}
+		err = c.Snooze(viper.GetStringSlice("action"), viper.GetStringSlice("uuid"), viper.GetStringSlice("rule"), until)
+		if err != nil {
+			fmt.Println("UNKNOWN: " + err.Error())
+			os.Exit(2)
+		}
+		return
+	},
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The subcommand "suggest" is called manually to find messages not covered by
+// the rules of an action
+var suggestCmd = &cobra.Command{
+	Use:   "suggest",
+	Short: "Suggest rules for unmatched messages",
+	Long: `Runs the query of an action over a time range and clusters the messages not matched by any rule into templates.
+Rules with patterns for the most frequent templates are printed in the format of the action file.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindConnectionFlags(cmd)
+		bindFlags(cmd, "from", "to", "top")
+		setupLogging()
+		err := HandleConfigFile()
+		if err != nil {
+			fmt.Println("Config error")
+			panic(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var c *check.Check
+
+		actions := viper.GetStringSlice("action")
+		if len(actions) != 1 {
+			fmt.Println("Exactly one action must be given with --action")
+			os.Exit(2)
+		}
+		now := time.Now()
+		from, err := check.ParseTime(viper.GetString("from"), now)
+		if err != nil {
+			fmt.Println("Could not parse start of the time range: " + err.Error())
+			os.Exit(2)
+		}
+		to, err := check.ParseTime(viper.GetString("to"), now)
+		if err != nil {
+			fmt.Println("Could not parse end of the time range: " + err.Error())
+			os.Exit(2)
+		}
+		connection, err := newConnection()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Could not create connection to Elasticsearch")
+			os.Exit(2)
+		}
+		c, err = check.NewCheck(actionSource(), connection, nil, "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
+			os.Exit(2)
+		}
+		err = c.Suggest(actions[0], from, to, viper.GetString("field"), viper.GetFloat64("similarity"), viper.GetInt("top"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		return
+	},
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The subcommand "test" runs sample documents through the rules of an action
+// without connecting to Elasticsearch
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Test the rules of an action against sample documents",
+	Long: `Reads documents in the format of the hits returned by Elasticsearch from an NDJSON file or stdin and runs them through the rules of an action.
+For every document, the rules are printed in their order with the pattern or exclude deciding the result, followed by the counts and the Nagios output.
+Elasticsearch is not contacted and the status file is neither read nor written.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		bindFlags(cmd, "input")
+		setupLogging()
+		err := HandleConfigFile()
+		if err != nil {
+			fmt.Println("Config error")
+			panic(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		actions := viper.GetStringSlice("action")
+		if len(actions) != 1 {
+			fmt.Println("Exactly one action must be given with --action")
+			os.Exit(2)
+		}
+		input, name, err := openInput(viper.GetString("input"))
+		if err != nil {
+			fmt.Println("Could not open documents: " + err.Error())
+			os.Exit(2)
+		}
+		defer input.Close()
+		c, err := check.NewCheck(actionSource(), nil, nil, "")
+		if err != nil {
+			log.Fatal().Err(err).Msg("UNKNOWN: Could not create check")
+			os.Exit(2)
+		}
+		err = c.TestRules(actions[0], input, name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	},
+}
+
+// Opens the file with the documents, "-" reads them from stdin. Returns the
+// reader and the name to use in messages.
+func openInput(Filename string) (io.ReadCloser, string, error) {
+	if Filename == "" || Filename == "-" {
+		return os.Stdin, "stdin", nil
+	}
+	f, err := os.Open(Filename)
+	return f, Filename, err
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joernott/monitoring-check_log_elasticsearch/check_log_elasticsearch/check"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// The subcommand "validate" checks the action files without connecting to
+// Elasticsearch
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the action files",
+	Long: `Checks the action files against the JSON Schema and validates the regular expressions, thresholds, queries and metric names of all actions.
+All problems are printed with file and line. Elasticsearch is not contacted. Exits with 2 if problems were found.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		setupLogging()
+		err := HandleConfigFile()
+		if err != nil {
+			fmt.Println("Config error")
+			panic(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if viper.GetBool("schema") {
+			os.Stdout.Write(check.ActionSchema())
+			return
+		}
+		source := actionSource()
+		problems := check.Validate(source)
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			fmt.Printf("%v problem(s) found in %v\n", len(problems), source)
+			os.Exit(2)
+		}
+		fmt.Println("OK: " + source + " is valid")
+	},
+}
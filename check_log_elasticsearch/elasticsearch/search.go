@@ -83,18 +83,27 @@ func (e *Elasticsearch) Search(Index string, Query string) (*ElasticsearchResult
 // Retrieve an element from a HitResult, which may be a nested structure.
 // Needle is the name of the element to retrieve. For nested fields, the dot
 // notation can be used, e.g. "log.level" fetches the contents of "level" from
-// the "log" element.
+// the "log" element. As the fields API returns flat keys containing dots,
+// those are looked up first.
 func (haystack HitElement) Get(Needle string) (interface{}, bool) {
 	if len(haystack) == 0 {
 		return "", false
 	}
+	if value, ok := haystack[Needle]; ok {
+		return value, true
+	}
 	n := strings.Split(Needle, ".")
 	key := n[0]
 	if len(n) > 1 {
 		subkeys := strings.Join(n[1:], ".")
-		subvalues, ok := haystack[n[0]].(HitElement)
-		if !ok {
-			return "", ok
+		var subvalues HitElement
+		switch v := haystack[n[0]].(type) {
+		case HitElement:
+			subvalues = v
+		case map[string]interface{}:
+			subvalues = HitElement(v)
+		default:
+			return "", false
 		}
 		return subvalues.Get(subkeys)
 	}
@@ -113,3 +122,17 @@ func (haystack HitElement) GetString(Needle string) (string, bool) {
 	s, ok := haystack.Get(Needle)
 	return fmt.Sprintf("%v", s), ok
 }
+
+// Retrieve a single value from a HitResult. The fields API returns every
+// field as an array, if this array contains exactly one element, the element
+// itself is returned.
+func (haystack HitElement) GetValue(Needle string) (interface{}, bool) {
+	v, ok := haystack.Get(Needle)
+	if !ok {
+		return v, ok
+	}
+	if a, isArray := v.([]interface{}); isArray && len(a) == 1 {
+		return a[0], true
+	}
+	return v, true
+}